@@ -0,0 +1,447 @@
+package TinyBitcaskDBV3
+
+import "bytes"
+
+// node kinds of the adaptive radix tree, inner nodes grow from artNode4 to
+// artNode256 as children are added and shrink back as they are removed
+const (
+	artLeaf uint8 = iota
+	artNode4
+	artNode16
+	artNode48
+	artNode256
+)
+
+type artNode struct {
+	kind   uint8
+	prefix []byte // compressed path below the parent edge
+
+	// leaf
+	key []byte
+	pos *Pos
+
+	// inner node
+	leaf     *artNode // key that ends at this node
+	keys     []byte   // edge bytes of artNode4 and artNode16, sorted
+	index    *[256]uint8
+	children []*artNode
+	count    int
+}
+
+// artTree is an Indexer on top of an adaptive radix tree
+type artTree struct {
+	root   *artNode
+	length int
+}
+
+func newARTIndex() *artTree {
+	return &artTree{}
+}
+
+func (t *artTree) Size() int {
+	return t.length
+}
+
+func (t *artTree) Get(key []byte) (*Pos, bool) {
+	n, depth := t.root, 0
+	for n != nil {
+		if n.kind == artLeaf {
+			if bytes.Equal(n.key, key) {
+				return n.pos, true
+			}
+			return nil, false
+		}
+
+		if !bytes.HasPrefix(key[depth:], n.prefix) {
+			return nil, false
+		}
+		depth += len(n.prefix)
+		if depth == len(key) {
+			if n.leaf == nil {
+				return nil, false
+			}
+			return n.leaf.pos, true
+		}
+		n = n.child(key[depth])
+		depth++
+	}
+	return nil, false
+}
+
+func (t *artTree) Put(key []byte, pos *Pos) (*Pos, bool) {
+	key = append([]byte(nil), key...)
+	root, old, ok := t.root.insert(key, pos, 0)
+	t.root = root
+	if !ok {
+		t.length++
+	}
+	return old, ok
+}
+
+func (t *artTree) Delete(key []byte) (*Pos, bool) {
+	root, old, ok := t.root.remove(key, 0)
+	t.root = root
+	if ok {
+		t.length--
+	}
+	return old, ok
+}
+
+func (t *artTree) Iterator(start, end []byte, reverse bool) IndexIterator {
+	var items []indexItem
+	t.root.walk(nil, start, end, func(leaf *artNode) {
+		items = append(items, indexItem{key: leaf.key, pos: leaf.pos})
+	})
+	return newSliceIterator(items, reverse)
+}
+
+func newARTLeaf(key []byte, pos *Pos) *artNode {
+	return &artNode{kind: artLeaf, key: key, pos: pos}
+}
+
+// insert puts key below n, whose prefix starts at key[depth], and returns the
+// node that replaces n in its parent
+func (n *artNode) insert(key []byte, pos *Pos, depth int) (*artNode, *Pos, bool) {
+	if n == nil {
+		return newARTLeaf(key, pos), nil, false
+	}
+
+	if n.kind == artLeaf {
+		if bytes.Equal(n.key, key) {
+			old := n.pos
+			n.pos = pos
+			return n, old, true
+		}
+
+		// split the leaf into a node holding both keys
+		common := commonPrefix(n.key[depth:], key[depth:])
+		node := &artNode{kind: artNode4, prefix: append([]byte(nil), key[depth:depth+common]...)}
+		depth += common
+		node.addLeaf(n, depth)
+		node.addLeaf(newARTLeaf(key, pos), depth)
+		return node, nil, false
+	}
+
+	if common := commonPrefix(n.prefix, key[depth:]); common < len(n.prefix) {
+		// the key leaves the compressed path, split it at the mismatch
+		node := &artNode{kind: artNode4, prefix: n.prefix[:common:common]}
+		edge := n.prefix[common]
+		n.prefix = n.prefix[common+1:]
+		node.addChild(edge, n)
+		node.addLeaf(newARTLeaf(key, pos), depth+common)
+		return node, nil, false
+	}
+
+	depth += len(n.prefix)
+	if depth == len(key) {
+		if n.leaf != nil {
+			old := n.leaf.pos
+			n.leaf.pos = pos
+			return n, old, true
+		}
+		n.leaf = newARTLeaf(key, pos)
+		return n, nil, false
+	}
+
+	if child := n.child(key[depth]); child != nil {
+		next, old, ok := child.insert(key, pos, depth+1)
+		if next != child {
+			n.setChild(key[depth], next)
+		}
+		return n, old, ok
+	}
+
+	n = n.grow()
+	n.addChild(key[depth], newARTLeaf(key, pos))
+	return n, nil, false
+}
+
+// addLeaf hangs leaf below n at depth, either as n.leaf or as a child
+func (n *artNode) addLeaf(leaf *artNode, depth int) {
+	if len(leaf.key) == depth {
+		n.leaf = leaf
+		return
+	}
+	n.addChild(leaf.key[depth], leaf)
+}
+
+// remove deletes key below n and returns the node that replaces n in its parent
+func (n *artNode) remove(key []byte, depth int) (*artNode, *Pos, bool) {
+	if n == nil {
+		return nil, nil, false
+	}
+
+	if n.kind == artLeaf {
+		if bytes.Equal(n.key, key) {
+			return nil, n.pos, true
+		}
+		return n, nil, false
+	}
+
+	if !bytes.HasPrefix(key[depth:], n.prefix) {
+		return n, nil, false
+	}
+	depth += len(n.prefix)
+
+	var old *Pos
+	if depth == len(key) {
+		if n.leaf == nil {
+			return n, nil, false
+		}
+		old = n.leaf.pos
+		n.leaf = nil
+	} else {
+		child := n.child(key[depth])
+		if child == nil {
+			return n, nil, false
+		}
+		next, pos, ok := child.remove(key, depth+1)
+		if !ok {
+			return n, nil, false
+		}
+		old = pos
+		if next == nil {
+			n.removeChild(key[depth])
+		} else if next != child {
+			n.setChild(key[depth], next)
+		}
+	}
+
+	return n.collapse(), old, true
+}
+
+// collapse replaces a node left with a single entry by that entry and shrinks
+// nodes that became too sparse for their kind
+func (n *artNode) collapse() *artNode {
+	switch {
+	case n.count == 0:
+		return n.leaf
+	case n.count == 1 && n.leaf == nil:
+		edge, child := n.first()
+		if child.kind != artLeaf {
+			prefix := make([]byte, 0, len(n.prefix)+1+len(child.prefix))
+			prefix = append(prefix, n.prefix...)
+			prefix = append(prefix, edge)
+			child.prefix = append(prefix, child.prefix...)
+		}
+		return child
+	}
+	return n.shrink()
+}
+
+func (n *artNode) child(b byte) *artNode {
+	switch n.kind {
+	case artNode4, artNode16:
+		if i := bytes.IndexByte(n.keys, b); i >= 0 {
+			return n.children[i]
+		}
+	case artNode48:
+		if i := n.index[b]; i > 0 {
+			return n.children[i-1]
+		}
+	case artNode256:
+		return n.children[b]
+	}
+	return nil
+}
+
+func (n *artNode) setChild(b byte, child *artNode) {
+	switch n.kind {
+	case artNode4, artNode16:
+		n.children[bytes.IndexByte(n.keys, b)] = child
+	case artNode48:
+		n.children[n.index[b]-1] = child
+	case artNode256:
+		n.children[b] = child
+	}
+}
+
+// addChild adds a child under a new edge b, n must not be full
+func (n *artNode) addChild(b byte, child *artNode) {
+	switch n.kind {
+	case artNode4, artNode16:
+		i := 0
+		for i < len(n.keys) && n.keys[i] < b {
+			i++
+		}
+		n.keys = append(n.keys, 0)
+		copy(n.keys[i+1:], n.keys[i:])
+		n.keys[i] = b
+		n.children = append(n.children, nil)
+		copy(n.children[i+1:], n.children[i:])
+		n.children[i] = child
+	case artNode48:
+		n.children = append(n.children, child)
+		n.index[b] = uint8(len(n.children))
+	case artNode256:
+		n.children[b] = child
+	}
+	n.count++
+}
+
+func (n *artNode) removeChild(b byte) {
+	switch n.kind {
+	case artNode4, artNode16:
+		i := bytes.IndexByte(n.keys, b)
+		n.keys = append(n.keys[:i], n.keys[i+1:]...)
+		copy(n.children[i:], n.children[i+1:])
+		n.children[len(n.children)-1] = nil
+		n.children = n.children[:len(n.children)-1]
+	case artNode48:
+		// move the last slot into the freed one to keep children dense
+		i := n.index[b] - 1
+		last := len(n.children) - 1
+		if int(i) != last {
+			n.children[i] = n.children[last]
+			for edge, slot := range n.index {
+				if int(slot) == last+1 {
+					n.index[edge] = i + 1
+					break
+				}
+			}
+		}
+		n.children[last] = nil
+		n.children = n.children[:last]
+		n.index[b] = 0
+	case artNode256:
+		n.children[b] = nil
+	}
+	n.count--
+}
+
+// first returns the child under the smallest edge
+func (n *artNode) first() (byte, *artNode) {
+	switch n.kind {
+	case artNode4, artNode16:
+		return n.keys[0], n.children[0]
+	case artNode48:
+		for b, i := range n.index {
+			if i > 0 {
+				return byte(b), n.children[i-1]
+			}
+		}
+	case artNode256:
+		for b, child := range n.children {
+			if child != nil {
+				return byte(b), child
+			}
+		}
+	}
+	return 0, nil
+}
+
+// each calls fn for every child in edge order
+func (n *artNode) each(fn func(b byte, child *artNode)) {
+	switch n.kind {
+	case artNode4, artNode16:
+		for i, b := range n.keys {
+			fn(b, n.children[i])
+		}
+	case artNode48:
+		for b, i := range n.index {
+			if i > 0 {
+				fn(byte(b), n.children[i-1])
+			}
+		}
+	case artNode256:
+		for b, child := range n.children {
+			if child != nil {
+				fn(byte(b), child)
+			}
+		}
+	}
+}
+
+// grow returns n, or a copy of it with the next larger kind if n is full
+func (n *artNode) grow() *artNode {
+	switch {
+	case n.kind == artNode4 && n.count == 4:
+		return n.convert(artNode16)
+	case n.kind == artNode16 && n.count == 16:
+		return n.convert(artNode48)
+	case n.kind == artNode48 && n.count == 48:
+		return n.convert(artNode256)
+	}
+	return n
+}
+
+// shrink returns n, or a copy of it with the next smaller kind if n is sparse
+func (n *artNode) shrink() *artNode {
+	switch {
+	case n.kind == artNode16 && n.count <= 3:
+		return n.convert(artNode4)
+	case n.kind == artNode48 && n.count <= 12:
+		return n.convert(artNode16)
+	case n.kind == artNode256 && n.count <= 37:
+		return n.convert(artNode48)
+	}
+	return n
+}
+
+func (n *artNode) convert(kind uint8) *artNode {
+	node := &artNode{kind: kind, prefix: n.prefix, leaf: n.leaf}
+	switch kind {
+	case artNode48:
+		node.index = new([256]uint8)
+		node.children = make([]*artNode, 0, 48)
+	case artNode256:
+		node.children = make([]*artNode, 256)
+	default:
+		node.keys = make([]byte, 0, 16)
+		node.children = make([]*artNode, 0, 16)
+	}
+	n.each(node.addChild)
+	return node
+}
+
+// walk calls fn for every leaf below n with a key in [start, end) in key
+// order, path is the key up to n. Subtrees outside of the range are skipped,
+// walk returns false once it got past end.
+func (n *artNode) walk(path, start, end []byte, fn func(leaf *artNode)) bool {
+	if n == nil {
+		return true
+	}
+	if n.kind == artLeaf {
+		return n.visit(start, end, fn)
+	}
+
+	// every key below n starts with path
+	path = append(path[:len(path):len(path)], n.prefix...)
+	if end != nil && bytes.Compare(path, end) >= 0 {
+		return false
+	}
+	if !bytes.HasPrefix(start, path) && bytes.Compare(path, start) < 0 {
+		return true
+	}
+
+	if n.leaf != nil && !n.leaf.visit(start, end, fn) {
+		return false
+	}
+	more := true
+	n.each(func(b byte, child *artNode) {
+		if more {
+			more = child.walk(append(path[:len(path):len(path)], b), start, end, fn)
+		}
+	})
+	return more
+}
+
+// visit calls fn for leaf n if its key is in [start, end) and returns false
+// if the key is past end
+func (n *artNode) visit(start, end []byte, fn func(leaf *artNode)) bool {
+	if end != nil && bytes.Compare(n.key, end) >= 0 {
+		return false
+	}
+	if bytes.Compare(n.key, start) >= 0 {
+		fn(n)
+	}
+	return true
+}
+
+func commonPrefix(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,156 @@
+package TinyBitcaskDBV3
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+var (
+	ErrBatchCommitted = errors.New("write batch already committed")
+)
+
+// WriteBatch collects puts and deletes that Commit writes atomically. All
+// entries share a batch id and are followed by a commit marker, Open ignores
+// a batch whose marker never reached the disk.
+type WriteBatch struct {
+	db        *TinyDB
+	mu        sync.Mutex
+	entries   []*Entry
+	committed bool
+}
+
+func (db *TinyDB) NewWriteBatch() *WriteBatch {
+	return &WriteBatch{db: db}
+}
+
+func (wb *WriteBatch) Put(key, value []byte) error {
+	if err := wb.db.checkWrite(key, value); err != nil {
+		return err
+	}
+	return wb.add(NewEntry(key, value, Put, String))
+}
+
+func (wb *WriteBatch) Delete(key []byte) error {
+	if err := wb.db.checkWrite(key, nil); err != nil {
+		return err
+	}
+	return wb.add(NewEntry(key, nil, Delete, String))
+}
+
+func (wb *WriteBatch) add(e *Entry) error {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+
+	if wb.committed {
+		return ErrBatchCommitted
+	}
+	wb.entries = append(wb.entries, e)
+	return nil
+}
+
+// Len returns the number of puts and deletes in the batch
+func (wb *WriteBatch) Len() int {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	return len(wb.entries)
+}
+
+// Commit appends the batch with a single write and applies it to the index,
+// later entries for the same key win
+func (wb *WriteBatch) Commit() error {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+
+	if wb.committed {
+		return ErrBatchCommitted
+	}
+
+	return wb.db.write(false, func() error {
+		wb.committed = true
+		return wb.db.applyBatch(wb.entries)
+	})
+}
+
+// applyBatch writes entries as one commit and updates the index, the caller
+// must hold db.mu
+func (db *TinyDB) applyBatch(entries []*Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	positions, err := db.writeBatch(entries)
+	if err != nil {
+		return err
+	}
+
+	for i, e := range entries {
+		pos := positions[i]
+		if db.typedKeydir(e.Type) != nil {
+			db.applyRecord(e.Type, e.Meta.Key, e.Mark, pos)
+			continue
+		}
+		if e.Mark == Put {
+			if old, ok := db.indexPut(e.Meta.Key, pos); ok {
+				db.markDead(old)
+				db.keepVersion(e.Meta.Key, old, pos.Seq)
+			}
+			continue
+		}
+
+		db.markDead(pos)
+		if old, ok := db.indexDelete(e.Meta.Key); ok {
+			db.markDead(old)
+			db.keepVersion(e.Meta.Key, old, pos.Seq)
+		}
+	}
+	return nil
+}
+
+// writeBatch appends entries and their commit marker to the active file and
+// returns the position of every entry, the caller must hold db.mu. A batch is
+// never split across data files and all of its entries share one seq.
+func (db *TinyDB) writeBatch(entries []*Entry) ([]*Pos, error) {
+	db.batchID++
+	db.seq++
+	count := make([]byte, 4)
+	binary.BigEndian.PutUint32(count, uint32(len(entries)))
+	marker := NewEntry([]byte{}, count, BatchCommit, String)
+	marker.BatchID = db.batchID
+	marker.Seq = db.seq
+
+	size := marker.Size()
+	for _, e := range entries {
+		e.BatchID = db.batchID
+		e.Seq = db.seq
+		size += e.Size()
+	}
+
+	if err := db.rotateFor(size); err != nil {
+		return nil, err
+	}
+
+	start := len(db.wbuf.buf)
+	positions := make([]*Pos, 0, len(entries)+1)
+	for _, e := range append(entries[:len(entries):len(entries)], marker) {
+		pos, err := db.buffer(e)
+		if err != nil {
+			// no part of a batch may reach the file on its own
+			db.wbuf.buf = db.wbuf.buf[:start]
+			return nil, err
+		}
+		positions = append(positions, pos)
+	}
+	// the marker is garbage as soon as the batch is in the index
+	db.markDead(positions[len(entries)])
+	return positions[:len(entries)], nil
+}
+
+// batchRecord is an entry of a WriteBatch seen during replay, it is only
+// applied once the commit marker of its batch turns up
+type batchRecord struct {
+	typ  uint16
+	key  []byte
+	mark uint16
+	pos  *Pos
+}
@@ -0,0 +1,120 @@
+package TinyBitcaskDBV3
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestWriteBatch_Commit(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, WithMaxFileSize(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Put([]byte("batch_key_0"), []byte("old_value")); err != nil {
+		t.Fatal(err)
+	}
+
+	wb := db.NewWriteBatch()
+	for i := 1; i < 10; i++ {
+		if err := wb.Put([]byte(fmt.Sprintf("batch_key_%d", i)), []byte(fmt.Sprintf("batch_value_%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wb.Delete([]byte("batch_key_0"))
+	wb.Delete([]byte("batch_key_9"))
+	if wb.Len() != 11 {
+		t.Fatalf("Expected 11 entries in the batch, got %d", wb.Len())
+	}
+	if err := wb.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := wb.Put([]byte("batch_key_10"), nil); err != ErrBatchCommitted {
+		t.Fatalf("Expected ErrBatchCommitted, got %v", err)
+	}
+	if err := wb.Commit(); err != ErrBatchCommitted {
+		t.Fatalf("Expected ErrBatchCommitted, got %v", err)
+	}
+
+	check := func(db *TinyDB) {
+		for i := 0; i < 10; i++ {
+			key := []byte(fmt.Sprintf("batch_key_%d", i))
+			v, err := db.Get(key)
+			if i == 0 || i == 9 {
+				if err != ErrKeyNotFound {
+					t.Fatalf("Expected %s to be deleted, got %s, err: %v", key, v, err)
+				}
+				continue
+			}
+			if err != nil || string(v) != fmt.Sprintf("batch_value_%d", i) {
+				t.Fatalf("Expected batch_value_%d, got %s, err: %v", i, v, err)
+			}
+		}
+	}
+
+	check(db)
+	db.Close()
+	if db, err = Open(dir, WithMaxFileSize(512)); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+	db.Close()
+	if db, err = Open(dir, WithMaxFileSize(512)); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(db)
+}
+
+func TestWriteBatch_Uncommitted(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wb := db.NewWriteBatch()
+	wb.Put([]byte("committed_key"), []byte("committed_value"))
+	if err := wb.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a crash after the entries of a batch but before its commit marker
+	for _, key := range []string{"committed_key", "torn_batch_key"} {
+		e := NewEntry([]byte(key), []byte("uncommitted_value"), Put, String)
+		e.BatchID = db.batchID + 1
+		if err := db.activeFile.Write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if v, err := db.Get([]byte("committed_key")); err != nil || string(v) != "committed_value" {
+		t.Fatalf("Expected committed_value, got %s, err: %v", v, err)
+	}
+	if v, err := db.Get([]byte("torn_batch_key")); err != ErrKeyNotFound {
+		t.Fatalf("Expected the uncommitted batch to be ignored, got %s, err: %v", v, err)
+	}
+
+	// batch ids keep growing past the ignored batch
+	wb = db.NewWriteBatch()
+	wb.Put([]byte("next_key"), []byte("next_value"))
+	if err := wb.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if db.batchID != 3 {
+		t.Fatalf("Expected batch id 3, got %d", db.batchID)
+	}
+}
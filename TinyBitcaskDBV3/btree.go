@@ -0,0 +1,300 @@
+package TinyBitcaskDBV3
+
+import "sort"
+
+const (
+	btreeDegree   = 32
+	btreeMaxItems = 2*btreeDegree - 1
+	btreeMinItems = btreeDegree - 1
+)
+
+type btreeItem struct {
+	key string
+	pos *Pos
+}
+
+type btreeNode struct {
+	items    []btreeItem
+	children []*btreeNode
+}
+
+// bTree is an in-memory B-tree from key to Pos that keeps the keys ordered
+type bTree struct {
+	root   *btreeNode
+	length int
+}
+
+func newBTree() *bTree {
+	return &bTree{}
+}
+
+func (t *bTree) Len() int {
+	return t.length
+}
+
+func (t *bTree) Get(key string) (*Pos, bool) {
+	for n := t.root; n != nil; {
+		i, found := n.find(key)
+		if found {
+			return n.items[i].pos, true
+		}
+		if len(n.children) == 0 {
+			break
+		}
+		n = n.children[i]
+	}
+	return nil, false
+}
+
+// Put sets key to pos and returns the Pos it replaced
+func (t *bTree) Put(key string, pos *Pos) (*Pos, bool) {
+	if t.root == nil {
+		t.root = &btreeNode{items: []btreeItem{{key: key, pos: pos}}}
+		t.length++
+		return nil, false
+	}
+
+	if len(t.root.items) >= btreeMaxItems {
+		item, second := t.root.split(btreeMaxItems / 2)
+		first := t.root
+		t.root = &btreeNode{items: []btreeItem{item}, children: []*btreeNode{first, second}}
+	}
+
+	old, ok := t.root.insert(key, pos)
+	if !ok {
+		t.length++
+	}
+	return old, ok
+}
+
+// Delete removes key and returns its Pos
+func (t *bTree) Delete(key string) (*Pos, bool) {
+	if t.root == nil || len(t.root.items) == 0 {
+		return nil, false
+	}
+
+	item, ok := t.root.remove(key)
+	if len(t.root.items) == 0 && len(t.root.children) > 0 {
+		t.root = t.root.children[0]
+	}
+	if !ok {
+		return nil, false
+	}
+
+	t.length--
+	return item.pos, true
+}
+
+// Ascend calls fn for every key >= from in ascending order until fn returns false
+func (t *bTree) Ascend(from string, fn func(key string, pos *Pos) bool) {
+	if t.root != nil {
+		t.root.ascend(from, fn)
+	}
+}
+
+// Descend calls fn for every key in descending order until fn returns false
+func (t *bTree) Descend(fn func(key string, pos *Pos) bool) {
+	if t.root != nil {
+		t.root.descend("", true, fn)
+	}
+}
+
+// DescendLessOrEqual calls fn for every key <= pivot in descending order
+// until fn returns false
+func (t *bTree) DescendLessOrEqual(pivot string, fn func(key string, pos *Pos) bool) {
+	if t.root != nil {
+		t.root.descend(pivot, false, fn)
+	}
+}
+
+// find returns the index of the first item >= key and whether it equals key
+func (n *btreeNode) find(key string) (int, bool) {
+	i := sort.Search(len(n.items), func(i int) bool { return n.items[i].key >= key })
+	return i, i < len(n.items) && n.items[i].key == key
+}
+
+// split moves the items after i into a new node and returns item i with it
+func (n *btreeNode) split(i int) (btreeItem, *btreeNode) {
+	item := n.items[i]
+	next := &btreeNode{items: append([]btreeItem(nil), n.items[i+1:]...)}
+	n.items = n.items[:i:i]
+	if len(n.children) > 0 {
+		next.children = append([]*btreeNode(nil), n.children[i+1:]...)
+		n.children = n.children[: i+1 : i+1]
+	}
+	return item, next
+}
+
+func (n *btreeNode) maybeSplitChild(i int) bool {
+	if len(n.children[i].items) < btreeMaxItems {
+		return false
+	}
+
+	item, second := n.children[i].split(btreeMaxItems / 2)
+	n.insertItemAt(i, item)
+	n.insertChildAt(i+1, second)
+	return true
+}
+
+func (n *btreeNode) insert(key string, pos *Pos) (*Pos, bool) {
+	i, found := n.find(key)
+	if found {
+		old := n.items[i].pos
+		n.items[i].pos = pos
+		return old, true
+	}
+
+	if len(n.children) == 0 {
+		n.insertItemAt(i, btreeItem{key: key, pos: pos})
+		return nil, false
+	}
+
+	if n.maybeSplitChild(i) {
+		switch median := n.items[i].key; {
+		case key > median:
+			i++
+		case key == median:
+			old := n.items[i].pos
+			n.items[i].pos = pos
+			return old, true
+		}
+	}
+	return n.children[i].insert(key, pos)
+}
+
+// remove deletes key from the subtree, every child it descends into is grown
+// first so that it can lose an item
+func (n *btreeNode) remove(key string) (btreeItem, bool) {
+	i, found := n.find(key)
+	if len(n.children) == 0 {
+		if found {
+			return n.removeItemAt(i), true
+		}
+		return btreeItem{}, false
+	}
+
+	if len(n.children[i].items) <= btreeMinItems {
+		n.growChild(i)
+		return n.remove(key)
+	}
+
+	if found {
+		// replace the item with its predecessor from the left subtree
+		out := n.items[i]
+		n.items[i] = n.children[i].removeMax()
+		return out, true
+	}
+	return n.children[i].remove(key)
+}
+
+func (n *btreeNode) removeMax() btreeItem {
+	if len(n.children) == 0 {
+		return n.removeItemAt(len(n.items) - 1)
+	}
+
+	i := len(n.items)
+	if len(n.children[i].items) <= btreeMinItems {
+		n.growChild(i)
+		return n.removeMax()
+	}
+	return n.children[i].removeMax()
+}
+
+// growChild gives child i an extra item by stealing from a sibling or by
+// merging it with one
+func (n *btreeNode) growChild(i int) {
+	switch {
+	case i > 0 && len(n.children[i-1].items) > btreeMinItems:
+		child, left := n.children[i], n.children[i-1]
+		child.insertItemAt(0, n.items[i-1])
+		n.items[i-1] = left.removeItemAt(len(left.items) - 1)
+		if len(left.children) > 0 {
+			child.insertChildAt(0, left.removeChildAt(len(left.children)-1))
+		}
+	case i < len(n.items) && len(n.children[i+1].items) > btreeMinItems:
+		child, right := n.children[i], n.children[i+1]
+		child.items = append(child.items, n.items[i])
+		n.items[i] = right.removeItemAt(0)
+		if len(right.children) > 0 {
+			child.children = append(child.children, right.removeChildAt(0))
+		}
+	default:
+		if i >= len(n.items) {
+			i--
+		}
+		child := n.children[i]
+		item := n.removeItemAt(i)
+		right := n.removeChildAt(i + 1)
+		child.items = append(child.items, item)
+		child.items = append(child.items, right.items...)
+		child.children = append(child.children, right.children...)
+	}
+}
+
+func (n *btreeNode) ascend(from string, fn func(key string, pos *Pos) bool) bool {
+	i, _ := n.find(from)
+	for ; i < len(n.items); i++ {
+		if len(n.children) > 0 && !n.children[i].ascend(from, fn) {
+			return false
+		}
+		if !fn(n.items[i].key, n.items[i].pos) {
+			return false
+		}
+	}
+
+	if len(n.children) > 0 {
+		return n.children[len(n.children)-1].ascend(from, fn)
+	}
+	return true
+}
+
+func (n *btreeNode) descend(pivot string, all bool, fn func(key string, pos *Pos) bool) bool {
+	i := len(n.items)
+	if !all {
+		var found bool
+		if i, found = n.find(pivot); found {
+			i++
+		}
+	}
+
+	if len(n.children) > 0 && !n.children[i].descend(pivot, all, fn) {
+		return false
+	}
+	for i--; i >= 0; i-- {
+		if !fn(n.items[i].key, n.items[i].pos) {
+			return false
+		}
+		if len(n.children) > 0 && !n.children[i].descend(pivot, all, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *btreeNode) insertItemAt(i int, item btreeItem) {
+	n.items = append(n.items, btreeItem{})
+	copy(n.items[i+1:], n.items[i:])
+	n.items[i] = item
+}
+
+func (n *btreeNode) removeItemAt(i int) btreeItem {
+	item := n.items[i]
+	copy(n.items[i:], n.items[i+1:])
+	n.items[len(n.items)-1] = btreeItem{}
+	n.items = n.items[:len(n.items)-1]
+	return item
+}
+
+func (n *btreeNode) insertChildAt(i int, child *btreeNode) {
+	n.children = append(n.children, nil)
+	copy(n.children[i+1:], n.children[i:])
+	n.children[i] = child
+}
+
+func (n *btreeNode) removeChildAt(i int) *btreeNode {
+	child := n.children[i]
+	copy(n.children[i:], n.children[i+1:])
+	n.children[len(n.children)-1] = nil
+	n.children = n.children[:len(n.children)-1]
+	return child
+}
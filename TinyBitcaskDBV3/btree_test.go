@@ -0,0 +1,65 @@
+package TinyBitcaskDBV3
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestBTree_RandomOps(t *testing.T) {
+	tree := newBTree()
+	expected := make(map[string]int64)
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		key := "key_" + strconv.Itoa(r.Intn(3000))
+		if r.Intn(3) == 0 {
+			_, ok := tree.Delete(key)
+			if _, exist := expected[key]; ok != exist {
+				t.Fatalf("Delete %s returned %v, expected %v", key, ok, exist)
+			}
+			delete(expected, key)
+		} else {
+			tree.Put(key, &Pos{Offset: int64(i)})
+			expected[key] = int64(i)
+		}
+	}
+
+	if tree.Len() != len(expected) {
+		t.Fatalf("Expected %d keys, got %d", len(expected), tree.Len())
+	}
+
+	keys := make([]string, 0, len(expected))
+	for key, offset := range expected {
+		keys = append(keys, key)
+		if pos, ok := tree.Get(key); !ok || pos.Offset != offset {
+			t.Fatalf("Get %s returned %v, expected offset %d", key, pos, offset)
+		}
+	}
+	sort.Strings(keys)
+
+	var ascended []string
+	tree.Ascend("", func(key string, pos *Pos) bool {
+		ascended = append(ascended, key)
+		return true
+	})
+	if len(ascended) != len(keys) {
+		t.Fatalf("Ascend returned %d keys, expected %d", len(ascended), len(keys))
+	}
+	for i := range keys {
+		if ascended[i] != keys[i] {
+			t.Fatalf("Ascend out of order at %d: %s != %s", i, ascended[i], keys[i])
+		}
+	}
+
+	pivot := keys[len(keys)/2]
+	var descended []string
+	tree.DescendLessOrEqual(pivot, func(key string, pos *Pos) bool {
+		descended = append(descended, key)
+		return true
+	})
+	if len(descended) != len(keys)/2+1 || descended[0] != pivot || descended[len(descended)-1] != keys[0] {
+		t.Fatalf("DescendLessOrEqual(%s) returned %d keys from %s", pivot, len(descended), descended[0])
+	}
+}
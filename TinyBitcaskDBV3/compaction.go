@@ -0,0 +1,249 @@
+package TinyBitcaskDBV3
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultMergeInterval      = time.Minute
+	DefaultMergeDeadRatio     = 0.5
+	DefaultMergeTotalSize     = 1 << 30 // 1GB
+	DefaultMergeSizeDeadRatio = 0.1
+)
+
+// AutoMergeConfig controls the background compaction
+type AutoMergeConfig struct {
+	Interval      time.Duration // how often the garbage is checked, 0 disables auto merge
+	DeadRatio     float64       // merge once dead bytes / total bytes reaches it, 0 disables
+	TotalSize     int64         // merge once all data files together reach it, 0 disables
+	SizeDeadRatio float64       // dead bytes / total bytes the TotalSize trigger needs as well
+	RateLimit     int64         // bytes per second a merge may read and write, 0 is unlimited
+}
+
+func DefaultAutoMergeConfig() AutoMergeConfig {
+	return AutoMergeConfig{
+		Interval:      DefaultMergeInterval,
+		DeadRatio:     DefaultMergeDeadRatio,
+		TotalSize:     DefaultMergeTotalSize,
+		SizeDeadRatio: DefaultMergeSizeDeadRatio,
+	}
+}
+
+// FileStat is the garbage accounting of a single data file
+type FileStat struct {
+	FileID     uint32
+	TotalBytes int64
+	DeadBytes  int64
+}
+
+// Stats describes how much of the data files is still referenced by the index
+type Stats struct {
+	Keys       int
+	TotalBytes int64
+	DeadBytes  int64
+	Files      []FileStat
+}
+
+// DeadRatio returns the share of bytes that a merge would reclaim
+func (s Stats) DeadRatio() float64 {
+	if s.TotalBytes == 0 {
+		return 0
+	}
+	return float64(s.DeadBytes) / float64(s.TotalBytes)
+}
+
+// Stats returns the live and dead bytes per data file
+func (db *TinyDB) Stats() Stats {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return Stats{}
+	}
+
+	stats := Stats{Keys: db.indexes.Size()}
+	fids := make([]uint32, 0, len(db.olderFiles)+1)
+	for fid := range db.olderFiles {
+		fids = append(fids, fid)
+	}
+	fids = append(fids, db.activeFile.FileID)
+	sortFileIDs(fids)
+
+	for _, fid := range fids {
+		fs := FileStat{FileID: fid, TotalBytes: db.getDBFile(fid).Offset, DeadBytes: db.deadBytes[fid]}
+		stats.TotalBytes += fs.TotalBytes
+		stats.DeadBytes += fs.DeadBytes
+		stats.Files = append(stats.Files, fs)
+	}
+
+	return stats
+}
+
+// markDead accounts an entry that is no longer referenced by the index, the
+// caller must hold db.mu
+func (db *TinyDB) markDead(pos *Pos) {
+	db.deadBytes[pos.FileID] += pos.Size
+}
+
+// resetDeadBytes recomputes the dead bytes of fids from the keydirs, the
+// caller must hold db.mu
+func (db *TinyDB) resetDeadBytes(fids ...uint32) {
+	live := make(map[uint32]int64, len(fids))
+	for _, fid := range fids {
+		live[fid] = 0
+	}
+
+	for _, kd := range db.keydirs() {
+		it := kd.Iterator(nil, nil, false)
+		for ; it.Valid(); it.Next() {
+			pos := it.Pos()
+			if _, ok := live[pos.FileID]; ok {
+				live[pos.FileID] += pos.Size
+			}
+		}
+		it.Close()
+	}
+
+	for fid, size := range live {
+		if dbFile := db.getDBFile(fid); dbFile != nil {
+			db.deadBytes[fid] = dbFile.Offset - size
+		} else {
+			delete(db.deadBytes, fid)
+		}
+	}
+}
+
+// autoMerger runs Merge in the background whenever the garbage crosses the
+// configured thresholds
+type autoMerger struct {
+	cfg    AutoMergeConfig
+	paused uint32
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// SetAutoMerge replaces the background compaction config and restarts it
+func (db *TinyDB) SetAutoMerge(cfg AutoMergeConfig) {
+	db.stopAutoMerge()
+
+	am := &autoMerger{cfg: cfg, stop: make(chan struct{})}
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return
+	}
+	db.autoMerger = am
+	db.mu.Unlock()
+
+	if cfg.Interval <= 0 {
+		return
+	}
+
+	am.wg.Add(1)
+	go func() {
+		defer am.wg.Done()
+		db.runAutoMerge(am)
+	}()
+}
+
+// PauseAutoMerge keeps the background compaction from starting new merges
+func (db *TinyDB) PauseAutoMerge() {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.autoMerger != nil {
+		atomic.StoreUint32(&db.autoMerger.paused, 1)
+	}
+}
+
+// ResumeAutoMerge undoes PauseAutoMerge
+func (db *TinyDB) ResumeAutoMerge() {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.autoMerger != nil {
+		atomic.StoreUint32(&db.autoMerger.paused, 0)
+	}
+}
+
+// stopAutoMerge stops the background compaction and waits for a running
+// merge to finish
+func (db *TinyDB) stopAutoMerge() {
+	db.mu.Lock()
+	am := db.autoMerger
+	db.autoMerger = nil
+	db.mu.Unlock()
+
+	if am != nil {
+		close(am.stop)
+		am.wg.Wait()
+	}
+}
+
+func (db *TinyDB) runAutoMerge(am *autoMerger) {
+	ticker := time.NewTicker(am.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-am.stop:
+			return
+		case <-ticker.C:
+			if atomic.LoadUint32(&am.paused) == 1 || !db.needMerge(am.cfg) {
+				continue
+			}
+			if err := db.Merge(); err != nil {
+				db.logf("auto merge err: %v\n", err)
+			}
+		}
+	}
+}
+
+func (db *TinyDB) needMerge(cfg AutoMergeConfig) bool {
+	return cfg.shouldMerge(db.Stats())
+}
+
+// shouldMerge reports whether stats cross one of the thresholds of cfg
+func (cfg AutoMergeConfig) shouldMerge(stats Stats) bool {
+	if stats.DeadBytes == 0 {
+		return false
+	}
+
+	if cfg.DeadRatio > 0 && stats.DeadRatio() >= cfg.DeadRatio {
+		return true
+	}
+	return cfg.TotalSize > 0 && stats.TotalBytes >= cfg.TotalSize && stats.DeadRatio() >= cfg.SizeDeadRatio
+}
+
+func (db *TinyDB) mergeRateLimit() int64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.autoMerger == nil {
+		return 0
+	}
+	return db.autoMerger.cfg.RateLimit
+}
+
+// rateLimiter throttles merge I/O to rate bytes per second
+type rateLimiter struct {
+	rate  int64
+	start time.Time
+	bytes int64
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{rate: rate, start: time.Now()}
+}
+
+// wait blocks until n more bytes fit into the rate
+func (rl *rateLimiter) wait(n int64) {
+	if rl.rate <= 0 {
+		return
+	}
+
+	rl.bytes += n
+	expected := time.Duration(float64(rl.bytes) / float64(rl.rate) * float64(time.Second))
+	if elapsed := time.Since(rl.start); expected > elapsed {
+		time.Sleep(expected - elapsed)
+	}
+}
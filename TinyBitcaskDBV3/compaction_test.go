@@ -0,0 +1,116 @@
+package TinyBitcaskDBV3
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTinyDB_Stats(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetAutoMerge(AutoMergeConfig{})
+
+	for i := 0; i < TestNum; i++ {
+		key := []byte("stats_key_" + strconv.Itoa(i%TestMod))
+		if err := db.Put(key, []byte("stats_value")); err != nil {
+			t.Fatal("Put err: ", err)
+		}
+	}
+
+	stats := db.Stats()
+	entrySize := NewEntry([]byte("stats_key_0"), []byte("stats_value"), Put, String).Size()
+	if stats.Keys != TestMod {
+		t.Errorf("Expected %d keys, got %d", TestMod, stats.Keys)
+	}
+	if stats.TotalBytes != TestNum*entrySize || stats.DeadBytes != (TestNum-TestMod)*entrySize {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	if err := db.Merge(); err != nil {
+		t.Fatal("merge err: ", err)
+	}
+	stats = db.Stats()
+	if stats.TotalBytes != TestMod*entrySize || stats.DeadBytes != 0 {
+		t.Errorf("Unexpected stats after merge: %+v", stats)
+	}
+}
+
+func TestAutoMergeConfig_ShouldMerge(t *testing.T) {
+	cfg := DefaultAutoMergeConfig()
+	tests := []struct {
+		stats    Stats
+		expected bool
+	}{
+		{Stats{TotalBytes: 100, DeadBytes: 0}, false},
+		{Stats{TotalBytes: 100, DeadBytes: 50}, true},
+		{Stats{TotalBytes: 100, DeadBytes: 49}, false},
+		// a large database needs some garbage before its size triggers a merge
+		{Stats{TotalBytes: cfg.TotalSize, DeadBytes: 1}, false},
+		{Stats{TotalBytes: cfg.TotalSize, DeadBytes: cfg.TotalSize / 5}, true},
+		{Stats{TotalBytes: cfg.TotalSize, DeadBytes: 0}, false},
+	}
+	for i, test := range tests {
+		if merge := cfg.shouldMerge(test.stats); merge != test.expected {
+			t.Errorf("%d: Expected %v for %+v, got %v", i, test.expected, test.stats, merge)
+		}
+	}
+
+	cfg.SizeDeadRatio = 0
+	if !cfg.shouldMerge(Stats{TotalBytes: cfg.TotalSize, DeadBytes: 1}) {
+		t.Error("Expected any garbage to trigger a merge without SizeDeadRatio")
+	}
+}
+
+func TestTinyDB_AutoMerge(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetAutoMerge(AutoMergeConfig{Interval: 10 * time.Millisecond, DeadRatio: 0.5})
+	db.PauseAutoMerge()
+
+	for i := 0; i < TestNum; i++ {
+		key := []byte("auto_key_" + strconv.Itoa(i%TestMod))
+		if err := db.Put(key, []byte("auto_value_"+strconv.Itoa(i))); err != nil {
+			t.Fatal("Put err: ", err)
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if stats := db.Stats(); stats.DeadBytes == 0 {
+		t.Fatal("Expected paused auto merge to leave the garbage")
+	}
+
+	db.ResumeAutoMerge()
+	deadline := time.Now().Add(time.Second)
+	for db.Stats().DeadBytes > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats := db.Stats(); stats.DeadBytes != 0 {
+		t.Fatalf("Expected auto merge to reclaim the garbage, got %+v", stats)
+	}
+	db.stopAutoMerge()
+
+	for i := TestNum - TestMod; i < TestNum; i++ {
+		key := []byte("auto_key_" + strconv.Itoa(i%TestMod))
+		if v, err := db.Get(key); err != nil || string(v) != "auto_value_"+strconv.Itoa(i) {
+			t.Fatalf("Expected %s=auto_value_%d, got %s instead, err: %v", key, i, string(v), err)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter(1000)
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		rl.wait(10)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected rate limiter to throttle, took %v", elapsed)
+	}
+}
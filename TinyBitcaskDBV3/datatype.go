@@ -0,0 +1,272 @@
+package TinyBitcaskDBV3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+var (
+	// ErrWrongType is returned by a read or removal of a key that only holds
+	// values of other types
+	ErrWrongType = errors.New("WRONGTYPE operation against a key holding the wrong kind of value")
+)
+
+// keydir maps the record keys of a data type to the position of their latest
+// record, Indexer is the keydir of String
+type keydir interface {
+	Put(key []byte, pos *Pos) (*Pos, bool)
+	Get(key []byte) (*Pos, bool)
+	Delete(key []byte) (*Pos, bool)
+	Iterator(start, end []byte, reverse bool) IndexIterator
+}
+
+// keydir returns the keydir records of type typ are indexed in
+func (db *TinyDB) keydir(typ uint16) keydir {
+	switch typ {
+	case List:
+		return db.lists
+	case Hash:
+		return db.hashes
+	case Set:
+		return db.sets
+	case ZSet:
+		return db.zsets
+	default:
+		return db.indexes
+	}
+}
+
+// typedKeydir is keydir for the types stored as sub-key records, nil for the
+// types that live in the String index
+func (db *TinyDB) typedKeydir(typ uint16) keydir {
+	if kd := db.keydir(typ); kd != keydir(db.indexes) {
+		return kd
+	}
+	return nil
+}
+
+// keydirs returns every keydir, String first
+func (db *TinyDB) keydirs() []keydir {
+	return []keydir{db.indexes, db.lists, db.hashes, db.sets, db.zsets}
+}
+
+// Type returns the types of the values at key in ascending order. Every type
+// has a keyspace of its own and a write only ever touches the keyspace of its
+// command, so a key can hold a string, a list, a hash, a set and a sorted set
+// at once. Type reports all of them rather than pick one.
+func (db *TinyDB) Type(key []byte) ([]uint16, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+
+	types := db.types(key)
+	if len(types) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	return types, nil
+}
+
+// types is Type with db.mu held
+func (db *TinyDB) types(key []byte) []uint16 {
+	var types []uint16
+	if _, ok := db.lookup(key); ok {
+		types = append(types, String)
+	}
+	if db.lists.meta(key) != nil {
+		types = append(types, List)
+	}
+	if db.hashes.members(key) != nil {
+		types = append(types, Hash)
+	}
+	if db.sets.members(key) != nil {
+		types = append(types, Set)
+	}
+	if db.zsets.get(key) != nil {
+		types = append(types, ZSet)
+	}
+	return types
+}
+
+// checkType fails with ErrWrongType if key holds no value of type typ but one
+// of another type. Reads and removals check it, writes never do, they add a
+// value of their own type next to the others. The caller must hold db.mu.
+func (db *TinyDB) checkType(key []byte, typ uint16) error {
+	types := db.types(key)
+	if len(types) == 0 {
+		return nil
+	}
+	for _, t := range types {
+		if t == typ {
+			return nil
+		}
+	}
+	return ErrWrongType
+}
+
+// encodeSubKey builds the record key of an element of the structure at key:
+// uvarint(len(key)) | key | sub. The length prefix keeps the elements of one
+// key apart from those of keys it is a prefix of.
+func encodeSubKey(key, sub []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen32+len(key)+len(sub))
+	n := binary.PutUvarint(buf, uint64(len(key)))
+	n += copy(buf[n:], key)
+	n += copy(buf[n:], sub)
+	return buf[:n]
+}
+
+// decodeSubKey splits a record key built by encodeSubKey
+func decodeSubKey(rk []byte) (key, sub []byte) {
+	size, n := binary.Uvarint(rk)
+	if n <= 0 || uint64(len(rk)-n) < size {
+		return nil, nil
+	}
+	return rk[n : n+int(size)], rk[n+int(size):]
+}
+
+// checkMember validates a write of value to member of the structure at key
+func (db *TinyDB) checkMember(key, member, value []byte) error {
+	if err := db.checkWrite(key, value); err != nil {
+		return err
+	}
+	if len(member) > db.opts.MaxKeySize {
+		return ErrKeyTooLong
+	}
+	return nil
+}
+
+// memberKeydir indexes records keyed by a key and a member, grouped by key so
+// that the members of one key are found without a scan
+type memberKeydir struct {
+	keys map[string]map[string]*Pos
+}
+
+func newMemberKeydir() *memberKeydir {
+	return &memberKeydir{keys: make(map[string]map[string]*Pos)}
+}
+
+func (m *memberKeydir) Put(rk []byte, pos *Pos) (*Pos, bool) {
+	key, member := decodeSubKey(rk)
+	members, ok := m.keys[string(key)]
+	if !ok {
+		members = make(map[string]*Pos)
+		m.keys[string(key)] = members
+	}
+	old, ok := members[string(member)]
+	members[string(member)] = pos
+	return old, ok
+}
+
+func (m *memberKeydir) Get(rk []byte) (*Pos, bool) {
+	key, member := decodeSubKey(rk)
+	pos, ok := m.keys[string(key)][string(member)]
+	return pos, ok
+}
+
+func (m *memberKeydir) Delete(rk []byte) (*Pos, bool) {
+	key, member := decodeSubKey(rk)
+	members := m.keys[string(key)]
+	pos, ok := members[string(member)]
+	if !ok {
+		return nil, false
+	}
+	delete(members, string(member))
+	if len(members) == 0 {
+		delete(m.keys, string(key))
+	}
+	return pos, true
+}
+
+// Iterator returns the records with a record key in [start, end) in record
+// key order
+func (m *memberKeydir) Iterator(start, end []byte, reverse bool) IndexIterator {
+	var items []indexItem
+	for key, members := range m.keys {
+		for member, pos := range members {
+			if rk := encodeSubKey([]byte(key), []byte(member)); inRange(rk, start, end) {
+				items = append(items, indexItem{key: rk, pos: pos})
+			}
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return bytes.Compare(items[i].key, items[j].key) < 0 })
+	return newSliceIterator(items, reverse)
+}
+
+// members returns the members of key and their records, nil if there are none
+func (m *memberKeydir) members(key []byte) map[string]*Pos {
+	return m.keys[string(key)]
+}
+
+// sortedMembers returns the members of key in ascending order
+func (m *memberKeydir) sortedMembers(key []byte) [][]byte {
+	members := m.keys[string(key)]
+	out := make([][]byte, 0, len(members))
+	for member := range members {
+		out = append(out, []byte(member))
+	}
+	sort.Slice(out, func(i, j int) bool { return bytes.Compare(out[i], out[j]) < 0 })
+	return out
+}
+
+// writeRecord appends a single record of a data type and applies it, the
+// caller must hold db.mu
+func (db *TinyDB) writeRecord(e *Entry) error {
+	pos, err := db.writeEntry(e)
+	if err != nil {
+		return err
+	}
+	db.applyRecord(e.Type, e.Meta.Key, e.Mark, pos)
+	return nil
+}
+
+// writeRecords appends the records of one operation, several of them as a
+// batch so that they apply all or nothing. The caller must hold db.mu.
+func (db *TinyDB) writeRecords(entries []*Entry) error {
+	if len(entries) == 1 {
+		return db.writeRecord(entries[0])
+	}
+	return db.applyBatch(entries)
+}
+
+// applyRecord points the keydir of typ at a record written or read back at
+// pos, the caller must hold db.mu
+func (db *TinyDB) applyRecord(typ uint16, key []byte, mark uint16, pos *Pos) {
+	kd := db.keydir(typ)
+	db.recordUndo(typ, key)
+
+	var (
+		old *Pos
+		ok  bool
+	)
+	if mark == Put {
+		old, ok = kd.Put(key, pos)
+	} else {
+		db.markDead(pos)
+		old, ok = kd.Delete(key)
+	}
+	if ok {
+		db.markDead(old)
+	}
+}
+
+// readRecord returns the value of the record key of type typ, the caller must
+// hold db.mu
+func (db *TinyDB) readRecord(typ uint16, key []byte) ([]byte, error) {
+	pos, ok := db.keydir(typ).Get(key)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	e, err := db.readEntry(pos)
+	if err != nil {
+		return nil, err
+	}
+	return e.Meta.Value, nil
+}
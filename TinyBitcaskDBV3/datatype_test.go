@@ -0,0 +1,161 @@
+package TinyBitcaskDBV3
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTinyDB_Type(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.Put([]byte("string_key"), []byte("value"))
+	db.RPush([]byte("list_key"), []byte("value"))
+	db.HSet([]byte("hash_key"), []byte("field"), []byte("value"))
+	db.SAdd([]byte("set_key"), []byte("member"))
+	db.ZAdd([]byte("zset_key"), 1, []byte("member"))
+
+	check := func(db *TinyDB) {
+		t.Helper()
+		for key, expected := range map[string]uint16{"string_key": String, "list_key": List, "hash_key": Hash, "set_key": Set, "zset_key": ZSet} {
+			if types, err := db.Type([]byte(key)); err != nil || !reflect.DeepEqual(types, []uint16{expected}) {
+				t.Fatalf("Expected type %d for %s, got %v, err: %v", expected, key, types, err)
+			}
+		}
+		if _, err := db.Type([]byte("missing")); err != ErrKeyNotFound {
+			t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+		}
+	}
+
+	check(db)
+	db.Close()
+	if db, err = Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(db)
+
+	if v, err := db.Get([]byte("string_key")); err != nil || string(v) != "value" {
+		t.Fatalf("Expected value, got %s, err: %v", v, err)
+	}
+}
+
+func TestTinyDB_Keyspaces(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// every type under the same key lives side by side
+	key := []byte("shared_key")
+	if err := db.Put(key, []byte("string_value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.HSet(key, []byte("field"), []byte("hash_value")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.LPush(key, []byte("list_value")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.SAdd(key, []byte("member")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ZAdd(key, 1, []byte("member")); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := db.Get(key); err != nil || string(v) != "string_value" {
+		t.Fatalf("Expected string_value, got %s, err: %v", v, err)
+	}
+	if v, err := db.HGet(key, []byte("field")); err != nil || string(v) != "hash_value" {
+		t.Fatalf("Expected hash_value, got %s, err: %v", v, err)
+	}
+	if v, err := db.LIndex(key, 0); err != nil || string(v) != "list_value" {
+		t.Fatalf("Expected list_value, got %s, err: %v", v, err)
+	}
+	if ok, err := db.SIsMember(key, []byte("member")); err != nil || !ok {
+		t.Fatalf("Expected member in the set, got %v, err: %v", ok, err)
+	}
+	if score, err := db.ZScore(key, []byte("member")); err != nil || score != 1 {
+		t.Fatalf("Expected score 1, got %v, err: %v", score, err)
+	}
+	if types, err := db.Type(key); err != nil || !reflect.DeepEqual(types, []uint16{String, List, Hash, Set, ZSet}) {
+		t.Fatalf("Expected every type, got %v, err: %v", types, err)
+	}
+
+	// removing one value leaves the others alone
+	if err := db.Del(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.HDel(key, []byte("field")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(key); err != ErrWrongType {
+		t.Fatalf("Expected ErrWrongType, got %v", err)
+	}
+	if types, err := db.Type(key); err != nil || !reflect.DeepEqual(types, []uint16{List, Set, ZSet}) {
+		t.Fatalf("Expected List, Set and ZSet, got %v, err: %v", types, err)
+	}
+}
+
+func TestTinyDB_WrongType(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	key := []byte("hash_key")
+	if err := db.HSet(key, []byte("field"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	// reads and removals of another type fail rather than report an empty value
+	if _, err := db.Get(key); err != ErrWrongType {
+		t.Fatalf("Expected ErrWrongType from Get, got %v", err)
+	}
+	if err := db.Del(key); err != ErrWrongType {
+		t.Fatalf("Expected ErrWrongType from Del, got %v", err)
+	}
+	if _, err := db.LPop(key); err != ErrWrongType {
+		t.Fatalf("Expected ErrWrongType from LPop, got %v", err)
+	}
+	if _, err := db.LLen(key); err != ErrWrongType {
+		t.Fatalf("Expected ErrWrongType from LLen, got %v", err)
+	}
+	if _, err := db.SMembers(key); err != ErrWrongType {
+		t.Fatalf("Expected ErrWrongType from SMembers, got %v", err)
+	}
+	if _, err := db.SRem(key, []byte("field")); err != ErrWrongType {
+		t.Fatalf("Expected ErrWrongType from SRem, got %v", err)
+	}
+	if _, err := db.SUnion(key, []byte("missing")); err != ErrWrongType {
+		t.Fatalf("Expected ErrWrongType from SUnion, got %v", err)
+	}
+	if _, err := db.ZScore(key, []byte("field")); err != ErrWrongType {
+		t.Fatalf("Expected ErrWrongType from ZScore, got %v", err)
+	}
+	if _, err := db.TTL(key); err != ErrWrongType {
+		t.Fatalf("Expected ErrWrongType from TTL, got %v", err)
+	}
+
+	// a missing key is not of the wrong type
+	if _, err := db.Get([]byte("missing")); err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	// a write adds a value of its own type, after which reads of it succeed
+	if err := db.Put(key, []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.Get(key); err != nil || string(v) != "value" {
+		t.Fatalf("Expected value, got %s, err: %v", v, err)
+	}
+	if v, err := db.HGet(key, []byte("field")); err != nil || string(v) != "value" {
+		t.Fatalf("Expected value, got %s, err: %v", v, err)
+	}
+}
@@ -2,17 +2,23 @@ package TinyBitcaskDBV3
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 )
 
 const (
 	DirName = "Data"
 )
 
+const (
+	DefaultMaxFileSize = 256 << 20 // 256MB
+)
+
 var DirPath string
 
 var (
@@ -20,6 +26,9 @@ var (
 	ErrEmptyRead     = errors.New("read empty entry")
 	ErrInvalidDBFile = errors.New("load Invalid DBFile")
 	ErrInvalidOffset = errors.New("merge error, offset is zero")
+	ErrReadOnly      = errors.New("database is read-only")
+	ErrDBClosed      = errors.New("database is closed")
+	ErrKeyNotFound   = errors.New("key not found")
 	// ErrEmptyValue = errors.New("empty value")
 )
 
@@ -33,104 +42,305 @@ func init() {
 	os.MkdirAll(DirPath, os.ModePerm)
 }
 
+// Pos locates an entry in the data files
+type Pos struct {
+	FileID    uint32
+	Offset    int64
+	Size      int64
+	ExpiresAt int64  // copied from the entry, 0 never expires
+	Seq       uint64 // commit sequence number of the entry
+}
+
+// expired reports whether the entry at pos has a TTL that ran out before now
+func (p *Pos) expired(now int64) bool {
+	return p.ExpiresAt > 0 && p.ExpiresAt <= now
+}
+
 type TinyDB struct {
-	indexes  map[string]int64 // key -> Offset
-	DataType uint16
-	dirPath  string
-	dbFile   *DBFile
-	mu       sync.RWMutex
+	indexes    Indexer       // key -> Pos
+	lists      *listKeydir   // List elements and bounds
+	hashes     *memberKeydir // Hash fields
+	sets       *memberKeydir // Set members
+	zsets      *zsetKeydir   // ZSet members and their order by score
+	opts       Options
+	dirPath    string
+	activeFile *DBFile
+	olderFiles map[uint32]*DBFile // immutable data files, fid -> DBFile
+	deadBytes  map[uint32]int64   // fid -> bytes no longer referenced by the index
+	ttlKeys    map[string]int64   // keys with a TTL -> ExpiresAt, walked by the sweeper
+	merging    bool
+	closed     bool
+	iterators  int       // open iterators
+	retired    []*DBFile // merged away files still read by iterators or transactions
+	autoMerger *autoMerger
+	syncer     *syncer
+	pipeline   writePipeline
+	wbuf       writeBuffer // appends of the running write group
+	ttlSweeper *ttlSweeper
+	batchID    uint64                // id of the last WriteBatch
+	seq        uint64                // sequence number of the last commit
+	snapshots  map[uint64]int        // start seq of open transactions -> count
+	versions   map[string][]*version // replaced entries still visible to open transactions
+	lock       *dirLock
+	mu         sync.RWMutex
 }
 
-func Open(dirPath string, dType uint16) (*TinyDB, error) {
-	if _, err := os.Stat(dirPath); err != nil {
-		if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
-			return nil, err
+// Open opens the database in dirPath, opts are applied on top of
+// DefaultOptions. The directory is locked until Close, a second Open fails
+// with ErrDatabaseLocked unless both are read-only. One database holds values
+// of every type, each command declares the type it reads or writes.
+func Open(dirPath string, opts ...Option) (*TinyDB, error) {
+	options := DefaultOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	if !options.ReadOnly {
+		if _, err := os.Stat(dirPath); err != nil {
+			if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+				return nil, err
+			}
 		}
 	}
 
-	dbFile, err := NewDBFile(dirPath)
+	lock, err := lockDir(dirPath, options.ReadOnly, options.FilePerm)
 	if err != nil {
 		return nil, err
 	}
 
 	db := &TinyDB{
-		dbFile:   dbFile,
-		indexes:  make(map[string]int64),
-		dirPath:  dirPath,
-		DataType: dType,
+		indexes:    newIndexer(options.IndexType),
+		lists:      newListKeydir(options.IndexType),
+		hashes:     newMemberKeydir(),
+		sets:       newMemberKeydir(),
+		zsets:      newZSetKeydir(),
+		dirPath:    dirPath,
+		opts:       options,
+		olderFiles: make(map[uint32]*DBFile),
+		deadBytes:  make(map[uint32]int64),
+		ttlKeys:    make(map[string]int64),
+		snapshots:  make(map[uint64]int),
+		versions:   make(map[string][]*version),
+		lock:       lock,
+	}
+	db.syncer = newSyncer(db)
+
+	if err := db.load(); err != nil {
+		db.closeFiles()
+		lock.release()
+		return nil, err
 	}
 
-	err = db.loadIndexFromFile(dbFile)
-	return db, err
+	if !options.ReadOnly {
+		db.SetAutoMerge(options.AutoMerge)
+		db.startTTLSweeper(options.TTLSweepInterval)
+		if options.SyncPolicy == SyncInterval {
+			db.syncer.start(options.SyncInterval)
+		}
+	}
+	return db, nil
 }
 
-func (db *TinyDB) Merge() error {
-	if db.dbFile.Offset == 0 {
-		return ErrInvalidOffset
+// load finishes an interrupted merge, opens the data files and rebuilds the
+// index and the data type structures from them
+func (db *TinyDB) load() error {
+	if !db.opts.ReadOnly {
+		if err := db.applyMerge(); err != nil {
+			return err
+		}
 	}
 
-	var (
-		validEntries []*Entry
-		offset       int64
-	)
+	fids, err := db.loadDataFiles()
+	if err != nil {
+		return err
+	}
 
-	for {
-		e, err := db.dbFile.Read(offset)
-		if err != nil {
-			if err == io.EOF {
-				break
+	for _, fid := range fids {
+		if fid != db.activeFile.FileID {
+			if err := db.loadIndexFromHint(fid); err == nil {
+				continue
+			} else if !os.IsNotExist(err) {
+				db.logf("load hint file %d err: %v, scan the data file instead\n", fid, err)
 			}
-			return err
 		}
 
-		if off, ok := db.indexes[string(e.Meta.Key)]; ok && off == offset {
-			validEntries = append(validEntries, e)
-			DPrintf("validEntries key: %s, value: %s, offset: %d\n", string(e.Meta.Key), string(e.Meta.Value), off)
+		if err := db.loadIndexFromFile(db.getDBFile(fid)); err != nil {
+			return err
 		}
+	}
 
-		offset += e.Size()
-		DPrintf("Read offset: %d\n", offset)
+	db.resetDeadBytes(fids...)
+	if err := db.loadZSets(); err != nil {
+		return err
 	}
 
-	if len(validEntries) > 0 {
-		mergeDBFile, err := NewMergeDBFile(db.dirPath)
-		if err != nil {
-			return err
+	if !db.opts.ReadOnly {
+		return db.migrateLegacy()
+	}
+	return nil
+}
+
+// Options returns the options the database was opened with
+func (db *TinyDB) Options() Options {
+	return db.opts
+}
+
+// loadDataFiles opens all data files in the directory, the newest one
+// becomes the active file. A data file of the first format cannot be migrated
+// by a read-only database and is refused rather than ignored.
+func (db *TinyDB) loadDataFiles() ([]uint32, error) {
+	legacy := filepath.Join(db.dirPath, LegacyFileName)
+	if _, err := os.Stat(legacy); err == nil && db.opts.ReadOnly {
+		return nil, fmt.Errorf("%w: %s", ErrLegacyDataFile, legacy)
+	}
+
+	fids, err := ListDataFileIDs(db.dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fids) == 0 {
+		if db.opts.ReadOnly {
+			return nil, fmt.Errorf("%w: no data file in %s", os.ErrNotExist, db.dirPath)
 		}
-		defer os.Remove(mergeDBFile.File.Name())
+		fids = []uint32{0}
+	}
 
-		for _, entry := range validEntries {
-			writeOff := mergeDBFile.Offset
-			err := mergeDBFile.Write(entry)
-			if err != nil {
-				return err
-			}
+	for i, fid := range fids {
+		dbFile, err := db.openDBFile(db.dirPath, fid)
+		if err != nil {
+			return nil, err
+		}
 
-			db.indexes[string(entry.Meta.Key)] = writeOff
+		if i == len(fids)-1 {
+			db.activeFile = dbFile
+		} else {
+			db.olderFiles[fid] = dbFile
 		}
+	}
+
+	return fids, nil
+}
+
+func (db *TinyDB) getDBFile(fid uint32) *DBFile {
+	if db.activeFile.FileID == fid {
+		return db.activeFile
+	}
+	return db.olderFiles[fid]
+}
 
-		os.Remove(db.dbFile.File.Name())
-		os.Rename(mergeDBFile.File.Name(), filepath.Join(DirPath, FileName))
+// openDBFile opens data file fid in path according to the options
+func (db *TinyDB) openDBFile(path string, fid uint32) (*DBFile, error) {
+	if db.opts.ReadOnly {
+		return OpenDBFile(path, fid, os.O_RDONLY, db.opts.FilePerm)
 	}
+	return OpenDBFile(path, fid, os.O_CREATE|os.O_RDWR|os.O_APPEND, db.opts.FilePerm)
+}
 
+// rotateFor rotates the active file if size more bytes would grow it past
+// MaxFileSize, the caller must hold db.mu
+func (db *TinyDB) rotateFor(size int64) error {
+	if end := db.activeFile.Offset + int64(len(db.wbuf.buf)); end > 0 && end+size > db.opts.MaxFileSize {
+		return db.rotate()
+	}
 	return nil
 }
 
-func (db *TinyDB) Put(key, value []byte) (err error) {
-	if len(key) == 0 {
-		err = ErrEmptyKey
+// rotate freezes the active file and opens a new one
+func (db *TinyDB) rotate() error {
+	if err := db.flush(); err != nil {
+		return err
+	}
+	if err := db.activeFile.Sync(); err != nil {
+		return err
+	}
+
+	dbFile, err := db.openDBFile(db.dirPath, db.activeFile.FileID+1)
+	if err != nil {
+		return err
+	}
+
+	db.olderFiles[db.activeFile.FileID] = db.activeFile
+	db.activeFile = dbFile
+	return nil
+}
+
+// writeEntry appends e to the active file as the next commit, the caller must
+// hold db.mu. The entry goes into the write buffer, it is on the file once the
+// write group is flushed.
+func (db *TinyDB) writeEntry(e *Entry) (*Pos, error) {
+	db.seq++
+	e.Seq = db.seq
+
+	if err := db.rotateFor(e.Size()); err != nil {
+		return nil, err
+	}
+
+	return db.buffer(e)
+}
+
+func (db *TinyDB) Put(key, value []byte) error {
+	return db.PutWithOptions(key, value, PutOptions{})
+}
+
+// PutWithOptions is Put with a per call override of the sync policy
+func (db *TinyDB) PutWithOptions(key, value []byte, opts PutOptions) (err error) {
+	if err = db.checkWrite(key, value); err != nil {
 		return
 	}
 
-	db.mu.Lock()
-	defer db.mu.Unlock()
+	return db.write(opts.Sync, func() error {
+		return db.put(key, value, 0)
+	})
+}
 
-	offset := db.dbFile.Offset
-	entry := NewEntry(key, value, Put, db.DataType)
-	err = db.dbFile.Write(entry)
+// put writes key with an optional expiry and points the index at it, the
+// caller must hold db.mu
+func (db *TinyDB) put(key, value []byte, expiresAt int64) error {
+	entry := NewEntry(key, value, Put, String)
+	entry.ExpiresAt = expiresAt
+	pos, err := db.writeEntry(entry)
+	if err != nil {
+		return err
+	}
 
-	db.indexes[string(key)] = offset
-	return
+	if old, ok := db.indexPut(key, pos); ok {
+		db.markDead(old)
+		db.keepVersion(key, old, pos.Seq)
+	}
+	return nil
+}
+
+// indexPut sets key in the index and keeps ttlKeys in step with it
+func (db *TinyDB) indexPut(key []byte, pos *Pos) (*Pos, bool) {
+	db.recordUndo(String, key)
+	if pos.ExpiresAt > 0 {
+		db.ttlKeys[string(key)] = pos.ExpiresAt
+	} else if len(db.ttlKeys) > 0 {
+		delete(db.ttlKeys, string(key))
+	}
+	return db.indexes.Put(key, pos)
+}
+
+// indexDelete drops key from the index and ttlKeys
+func (db *TinyDB) indexDelete(key []byte) (*Pos, bool) {
+	db.recordUndo(String, key)
+	if len(db.ttlKeys) > 0 {
+		delete(db.ttlKeys, string(key))
+	}
+	return db.indexes.Delete(key)
+}
+
+// lookup returns the Pos of key, an expired key is reported as missing
+func (db *TinyDB) lookup(key []byte) (*Pos, bool) {
+	pos, ok := db.indexes.Get(key)
+	if !ok || pos.expired(time.Now().UnixNano()) {
+		return nil, false
+	}
+	return pos, true
 }
 
 func (db *TinyDB) Get(key []byte) (val []byte, err error) {
@@ -142,39 +352,96 @@ func (db *TinyDB) Get(key []byte) (val []byte, err error) {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
-	offset, ok := db.indexes[string(key)]
+	if db.closed {
+		err = ErrDBClosed
+		return
+	}
+	if err = db.checkType(key, String); err != nil {
+		return
+	}
+
+	pos, ok := db.lookup(key)
 	if !ok {
+		err = ErrKeyNotFound
 		return
 	}
 
 	var e *Entry
-	e, err = db.dbFile.Read(offset)
-	if err != nil && err != io.EOF {
+	if e, err = db.readEntry(pos); err != nil {
 		return
 	}
 
-	if e != nil {
-		val = e.Meta.Value
+	val = e.Meta.Value
+	return
+}
+
+// readEntry reads the entry at pos, a write still in the write buffer is
+// flushed first, the caller must hold db.mu
+func (db *TinyDB) readEntry(pos *Pos) (*Entry, error) {
+	if pos.FileID == db.activeFile.FileID && pos.Offset >= db.activeFile.Offset {
+		if err := db.flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	dbFile := db.getDBFile(pos.FileID)
+	if dbFile == nil {
+		return nil, fmt.Errorf("%w: data file %d is missing", ErrInvalidDBFile, pos.FileID)
 	}
 
-	return
+	return dbFile.ReadSized(pos.Offset, pos.Size)
 }
 
+// Del appends a tombstone for key and drops it from the index, deleting a
+// missing or expired key is a no-op
 func (db *TinyDB) Del(key []byte) (err error) {
-	if len(key) == 0 {
-		err = ErrEmptyKey
+	if err = db.checkWrite(key, nil); err != nil {
 		return
 	}
 
-	db.mu.Lock()
-	defer db.mu.Unlock()
+	return db.write(false, func() error {
+		if err := db.checkType(key, String); err != nil {
+			return err
+		}
+		return db.del(key)
+	})
+}
 
-	offset := db.dbFile.Offset
-	entry := NewEntry(key, nil, Delete, db.DataType)
-	err = db.dbFile.Write(entry)
+// del writes a tombstone for key if it exists, the caller must hold db.mu
+func (db *TinyDB) del(key []byte) error {
+	old, ok := db.lookup(key)
+	if !ok {
+		return nil
+	}
 
-	db.indexes[string(key)] = offset
-	return
+	entry := NewEntry(key, nil, Delete, String)
+	pos, err := db.writeEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	// the tombstone is garbage as soon as it is written, it only has to
+	// outlive the entries it shadows until they are merged away
+	db.markDead(old)
+	db.markDead(pos)
+	db.indexDelete(key)
+	db.keepVersion(key, old, pos.Seq)
+	return nil
+}
+
+// checkWrite validates a write against the options
+func (db *TinyDB) checkWrite(key, value []byte) error {
+	switch {
+	case db.opts.ReadOnly:
+		return ErrReadOnly
+	case len(key) == 0:
+		return ErrEmptyKey
+	case len(key) > db.opts.MaxKeySize:
+		return ErrKeyTooLong
+	case len(value) > db.opts.MaxValueSize:
+		return ErrValueTooLong
+	}
+	return nil
 }
 
 func (db *TinyDB) loadIndexFromFile(dbFile *DBFile) error {
@@ -183,27 +450,200 @@ func (db *TinyDB) loadIndexFromFile(dbFile *DBFile) error {
 	}
 
 	var offset int64
+	now := time.Now().UnixNano()
+	pending := make(map[uint64][]batchRecord)
 	for {
-		e, err := db.dbFile.Read(offset)
+		e, err := dbFile.Read(offset)
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
+			if dbFile == db.activeFile && db.isTornWrite(dbFile, offset, err) {
+				return db.recoverTornWrite(dbFile, offset, err)
+			}
 			return err
 		}
 
-		if e.Mark == Put {
-			db.indexes[string(e.Meta.Key)] = offset
+		pos := &Pos{FileID: dbFile.FileID, Offset: offset, Size: e.Size(), ExpiresAt: e.ExpiresAt, Seq: e.Seq}
+		switch {
+		case e.Mark == BatchCommit:
+			for _, r := range pending[e.BatchID] {
+				db.replay(r.typ, r.key, r.mark, r.pos, now)
+			}
+			delete(pending, e.BatchID)
+		case e.BatchID > 0:
+			pending[e.BatchID] = append(pending[e.BatchID], batchRecord{typ: e.Type, key: e.Meta.Key, mark: e.Mark, pos: pos})
+		default:
+			db.replay(e.Type, e.Meta.Key, e.Mark, pos, now)
+		}
+		if e.BatchID > db.batchID {
+			db.batchID = e.BatchID
+		}
+		if e.Seq > db.seq {
+			db.seq = e.Seq
 		}
 
 		offset += e.Size()
 	}
 
+	for id := range pending {
+		db.logf("ignore uncommitted batch %d in data file %d\n", id, dbFile.FileID)
+	}
+	return nil
+}
+
+// replay applies an entry read back from disk to the keydir of its type, an
+// expired entry shadows older versions of its key like a tombstone
+func (db *TinyDB) replay(typ uint16, key []byte, mark uint16, pos *Pos, now int64) {
+	if kd := db.typedKeydir(typ); kd != nil {
+		if mark == Put {
+			kd.Put(key, pos)
+		} else {
+			kd.Delete(key)
+		}
+		return
+	}
+
+	if mark == Put && !pos.expired(now) {
+		db.indexPut(key, pos)
+	} else {
+		db.indexDelete(key)
+	}
+}
+
+// isTornWrite reports whether err at offset starts a tail that a crash left
+// half written. A write group or batch goes out with a single write, so the
+// tail may span several entries: it is torn as long as nothing after offset
+// is a committed entry, i.e. the rest is zeroed, unparseable or belongs to
+// batches whose commit marker never made it.
+func (db *TinyDB) isTornWrite(dbFile *DBFile, offset int64, err error) bool {
+	if !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, ErrInvalidCrc32) {
+		return false
+	}
+	return !committedAfter(dbFile, offset)
+}
+
+// committedAfter reports whether an intact entry outside of a batch, or the
+// commit marker of a batch, follows the damaged entry at offset
+func committedAfter(dbFile *DBFile, offset int64) bool {
+	header := make([]byte, entryHeaderSize)
+	for offset < dbFile.Offset {
+		if _, err := dbFile.File.ReadAt(header, offset); err != nil {
+			return false
+		}
+		h, err := Decode(header)
+		if err != nil || offset+h.Size() > dbFile.Offset {
+			return false
+		}
+
+		if e, err := dbFile.ReadSized(offset, h.Size()); err == nil && (e.BatchID == 0 || e.Mark == BatchCommit) {
+			return true
+		}
+		offset += h.Size()
+	}
+	return false
+}
+
+// recoverTornWrite drops the torn tail from offset on if TruncateTornWrites is
+// on, a read-only database only stops indexing there
+func (db *TinyDB) recoverTornWrite(dbFile *DBFile, offset int64, err error) error {
+	if !db.opts.TruncateTornWrites {
+		return err
+	}
+
+	db.logf("truncate torn write in data file %d at offset %d: %v\n", dbFile.FileID, offset, err)
+	if db.opts.ReadOnly {
+		return nil
+	}
+	return dbFile.Truncate(offset)
+}
+
+// loadIndexFromHint rebuilds the index of data file fid from its hint file,
+// the index is left untouched if the hint file is missing or corrupted
+func (db *TinyDB) loadIndexFromHint(fid uint32) error {
+	if _, err := os.Stat(HintFileName(db.dirPath, fid)); err != nil {
+		return err
+	}
+
+	hintFile, err := OpenHintFile(db.dirPath, fid, os.O_RDONLY, db.opts.FilePerm)
+	if err != nil {
+		return err
+	}
+	defer hintFile.Close()
+
+	hints, err := hintFile.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UnixNano()
+	for _, h := range hints {
+		db.replay(h.Type, h.Key, h.Mark, h.Pos(), now)
+		if h.Seq > db.seq {
+			db.seq = h.Seq
+		}
+	}
+
 	return nil
 }
 
-func (db *TinyDB) Sync() error{
-	return db.dbFile.Sync()
+// Sync fsyncs every write so far, whatever the sync policy
+func (db *TinyDB) Sync() error {
+	db.mu.RLock()
+	closed := db.closed
+	db.mu.RUnlock()
+
+	if closed {
+		return ErrDBClosed
+	}
+	return db.syncer.wait(db.syncer.ticket())
 }
 
-// TODO: if file larger than the threshed, auto merge
\ No newline at end of file
+// Close stops the background compaction, TTL sweeper and flusher, persists
+// the active file, releases all data files and unlocks the directory. Every
+// later call returns ErrDBClosed.
+func (db *TinyDB) Close() error {
+	db.stopAutoMerge()
+	db.stopTTLSweeper()
+	db.syncer.close()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrDBClosed
+	}
+	db.closed = true
+
+	var err error
+	if !db.opts.ReadOnly {
+		err = db.activeFile.Sync()
+	}
+
+	if cerr := db.closeFiles(); err == nil {
+		err = cerr
+	}
+	if cerr := db.lock.release(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// closeFiles closes every open data file and returns the first error
+func (db *TinyDB) closeFiles() (err error) {
+	if db.activeFile != nil {
+		err = db.activeFile.Close()
+	}
+	for _, dbFile := range db.retired {
+		if cerr := dbFile.Close(); err == nil {
+			err = cerr
+		}
+	}
+	for _, dbFile := range db.olderFiles {
+		if cerr := dbFile.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return
+}
@@ -1,10 +1,16 @@
 package TinyBitcaskDBV3
 
 import (
+	"bufio"
 	"errors"
+	"fmt"
 	"hash/crc32"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -12,86 +18,237 @@ const (
 )
 
 const (
-	FileName      = "TinyDB.data"
-	MergeFileName = "Tiny.data.merge"
+	DataFileSuffix = ".data"
+	MergeDirName   = "Tiny.data.merge"
+	LegacyFileName = "TinyDB.data" // single data file of the first format
 )
 
 var (
-	ErrInvalidCrc32 = errors.New("crc32 is error")
+	ErrInvalidCrc32   = errors.New("crc32 is error")
+	ErrLegacyDataFile = errors.New("data file of the first format, open it writable to migrate it")
 )
 
 type DBFile struct {
 	File   *os.File
+	FileID uint32
 	Offset int64
 }
 
 func CreateNewDBFile(fileName string) (*DBFile, error) {
-	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, DefaultFilePerm)
+	return createDBFile(fileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, DefaultFilePerm)
+}
+
+func createDBFile(fileName string, flag int, perm os.FileMode) (*DBFile, error) {
+	file, err := os.OpenFile(fileName, flag, perm)
 	if err != nil {
 		return nil, err
 	}
 
-	stat, err := os.Stat(fileName)
+	stat, err := file.Stat()
 	if err != nil {
+		file.Close()
 		return nil, err
 	}
 
 	return &DBFile{Offset: stat.Size(), File: file}, nil
 }
 
-func NewDBFile(path string) (*DBFile, error) {
-	fileName := filepath.Join(path, FileName)
-	return CreateNewDBFile(fileName)
+// NewDBFile opens the data file with id fid in path, creating it if needed
+func NewDBFile(path string, fid uint32) (*DBFile, error) {
+	return OpenDBFile(path, fid, os.O_CREATE|os.O_RDWR|os.O_APPEND, DefaultFilePerm)
 }
 
-func NewMergeDBFile(path string) (*DBFile, error) {
-	fileName := filepath.Join(path, MergeFileName)
-	return CreateNewDBFile(fileName)
+// OpenDBFile opens the data file with id fid in path with the given flag and
+// permission
+func OpenDBFile(path string, fid uint32, flag int, perm os.FileMode) (*DBFile, error) {
+	df, err := createDBFile(DataFileName(path, fid), flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	df.FileID = fid
+	return df, nil
+}
+
+// DataFileName returns the name of the data file with id fid in path
+func DataFileName(path string, fid uint32) string {
+	return filepath.Join(path, fmt.Sprintf("%09d%s", fid, DataFileSuffix))
 }
 
+// ListDataFileIDs returns the ids of all data files in path in ascending order
+func ListDataFileIDs(path string) ([]uint32, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fids []uint32
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, DataFileSuffix) {
+			continue
+		}
+
+		fid, err := strconv.ParseUint(strings.TrimSuffix(name, DataFileSuffix), 10, 32)
+		if err != nil {
+			continue
+		}
+		fids = append(fids, uint32(fid))
+	}
+
+	sortFileIDs(fids)
+	return fids, nil
+}
+
+func sortFileIDs(fids []uint32) {
+	sort.Slice(fids, func(i, j int) bool { return fids[i] < fids[j] })
+}
+
+// Read decodes the entry at offset and verifies its checksum over header, key
+// and value. io.EOF means offset is the end of the file, a damaged or cut off
+// entry is returned as a *CorruptionError.
 func (df *DBFile) Read(offset int64) (e *Entry, err error) {
-	buf := make([]byte, entryHeaderSize)
-	if _, err = df.File.ReadAt(buf, offset); err != nil {
-		return
+	header := make([]byte, entryHeaderSize)
+	if n, err := df.File.ReadAt(header, offset); err != nil {
+		if err == io.EOF && n == 0 {
+			return nil, io.EOF
+		}
+		return nil, df.readError(offset, err)
 	}
 
-	if e, err = Decode(buf); err != nil {
-		return
+	if e, err = Decode(header); err != nil {
+		return nil, df.corrupted(offset, err)
+	}
+	if offset+e.Size() > df.Offset {
+		return nil, df.corrupted(offset, io.ErrUnexpectedEOF)
 	}
 
-	offset += entryHeaderSize
-	if e.Meta.KeySize > 0 {
-		key := make([]byte, e.Meta.KeySize)
-		if _, err = df.File.ReadAt(key, offset); err != nil {
-			return
+	buf := make([]byte, e.Size())
+	copy(buf, header)
+	if e.Size() > entryHeaderSize {
+		if _, err = df.File.ReadAt(buf[entryHeaderSize:], offset+entryHeaderSize); err != nil {
+			return nil, df.readError(offset, err)
 		}
-		e.Meta.Key = key
+	}
+	return df.decodeBody(offset, e, buf)
+}
+
+// ReadSized is Read for an entry whose size is known from the keydir, header,
+// key and value come in with a single ReadAt
+func (df *DBFile) ReadSized(offset, size int64) (*Entry, error) {
+	if size < entryHeaderSize || offset+size > df.Offset {
+		return nil, df.corrupted(offset, io.ErrUnexpectedEOF)
+	}
+
+	buf := make([]byte, size)
+	if _, err := df.File.ReadAt(buf, offset); err != nil {
+		return nil, df.readError(offset, err)
 	}
 
-	offset += int64(e.Meta.KeySize)
-	if e.Meta.ValueSize > 0 {
-		value := make([]byte, e.Meta.ValueSize)
-		if _, err = df.File.ReadAt(value, offset); err != nil {
-			return
+	e, err := Decode(buf)
+	if err != nil {
+		return nil, df.corrupted(offset, err)
+	}
+	if e.Size() != size {
+		return nil, df.corrupted(offset, ErrInvalidEntry)
+	}
+	return df.decodeBody(offset, e, buf)
+}
+
+// entryReader reads the entries of a data file front to back through a read
+// ahead buffer, so a scan neither reads nor allocates twice per entry
+type entryReader struct {
+	df     *DBFile
+	r      *bufio.Reader
+	offset int64
+}
+
+func (df *DBFile) newEntryReader() *entryReader {
+	return &entryReader{df: df, r: bufio.NewReaderSize(io.NewSectionReader(df.File, 0, df.Offset), 64<<10)}
+}
+
+// Next returns the entry at the offset of the reader with the errors of Read,
+// io.EOF once it reached the end of the file
+func (er *entryReader) Next() (*Entry, error) {
+	offset := er.offset
+	header, err := er.r.Peek(entryHeaderSize)
+	if err != nil {
+		if err == io.EOF && len(header) == 0 {
+			return nil, io.EOF
 		}
-		e.Meta.Value = value
+		return nil, er.df.readError(offset, err)
+	}
+
+	e, err := Decode(header)
+	if err != nil {
+		return nil, er.df.corrupted(offset, err)
+	}
+	if offset+e.Size() > er.df.Offset {
+		return nil, er.df.corrupted(offset, io.ErrUnexpectedEOF)
+	}
+
+	buf := make([]byte, e.Size())
+	if _, err := io.ReadFull(er.r, buf); err != nil {
+		return nil, er.df.readError(offset, err)
 	}
+	er.offset += e.Size()
+	return er.df.decodeBody(offset, e, buf)
+}
 
+// decodeBody fills in key and value of e from buf, the whole encoded entry,
+// and verifies the checksum. Key and value share buf.
+func (df *DBFile) decodeBody(offset int64, e *Entry, buf []byte) (*Entry, error) {
 	if e.Crc != crc32.ChecksumIEEE(buf[4:]) {
-		// TODO: crc32 check is always error but the decode result is true
-		// err = ErrInvalidCrc32
+		return nil, df.corrupted(offset, ErrInvalidCrc32)
 	}
-	return
+
+	ks, vs := e.Meta.KeySize, e.Meta.ValueSize
+	if ks > 0 {
+		e.Meta.Key = buf[entryHeaderSize : entryHeaderSize+ks : entryHeaderSize+ks]
+	}
+	if vs > 0 {
+		e.Meta.Value = buf[entryHeaderSize+ks : entryHeaderSize+ks+vs : entryHeaderSize+ks+vs]
+	}
+	return e, nil
+}
+
+func (df *DBFile) corrupted(offset int64, err error) error {
+	return &CorruptionError{FileID: df.FileID, Offset: offset, Err: err}
+}
+
+// readError turns a short read into corruption and adds context to the rest
+func (df *DBFile) readError(offset int64, err error) error {
+	if err == io.EOF {
+		return df.corrupted(offset, io.ErrUnexpectedEOF)
+	}
+	return fmt.Errorf("read data file %d at offset %d: %w", df.FileID, offset, err)
 }
 
 func (df *DBFile) Write(e *Entry) (err error) {
-	enc, err := e.Encode()
-	if err != nil {
+	bp := encodePool.Get().(*[]byte)
+	defer encodePool.Put(bp)
+
+	if *bp, err = e.AppendEncode((*bp)[:0]); err != nil {
 		return
 	}
+	return df.writeRaw(*bp)
+}
+
+// writeRaw appends already encoded entries in a single write
+func (df *DBFile) writeRaw(buf []byte) (err error) {
+	if _, err = df.File.Write(buf); err != nil {
+		return fmt.Errorf("write data file %d: %w", df.FileID, err)
+	}
+	df.Offset += int64(len(buf))
+	return
+}
 
-	_, err = df.File.Write(enc)
-	df.Offset += e.Size()
+// Truncate cuts the file at offset, dropping a torn trailing entry
+func (df *DBFile) Truncate(offset int64) (err error) {
+	if err = df.File.Truncate(offset); err != nil {
+		return fmt.Errorf("truncate data file %d at offset %d: %w", df.FileID, offset, err)
+	}
+	df.Offset = offset
 	return
 }
 
@@ -103,6 +260,8 @@ func (df *DBFile) Close() (err error) {
 
 // Persist data into disk
 func (df *DBFile) Sync() (err error) {
-	err = df.File.Sync()
+	if err = df.File.Sync(); err != nil {
+		return fmt.Errorf("sync data file %d: %w", df.FileID, err)
+	}
 	return
 }
@@ -1,6 +1,10 @@
 package TinyBitcaskDBV3
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -30,14 +34,14 @@ func init() {
 }
 
 func TestNewDBFile(t *testing.T) {
-	_, err := NewDBFile(TmpPath)
+	_, err := NewDBFile(TmpPath, 0)
 	if err != nil {
 		t.Error(err)
 	}
 }
 
 func TestDBFile_Sync(t *testing.T) {
-	df, err := NewDBFile(TmpPath)
+	df, err := NewDBFile(TmpPath, 0)
 	if err != nil {
 		t.Error(err)
 	}
@@ -48,7 +52,7 @@ func TestDBFile_Sync(t *testing.T) {
 }
 
 func TestDBFile_Close(t *testing.T) {
-	df, err := NewDBFile(TmpPath)
+	df, err := NewDBFile(TmpPath, 0)
 	if err != nil {
 		t.Error(err)
 	}
@@ -59,7 +63,7 @@ func TestDBFile_Close(t *testing.T) {
 }
 
 func TestDBFile_WriteAndRead(t *testing.T) {
-	df, err := NewDBFile(TmpPath)
+	df, err := NewDBFile(TmpPath, 0)
 	if err != nil {
 		t.Error(err)
 	}
@@ -70,12 +74,12 @@ func TestDBFile_WriteAndRead(t *testing.T) {
 	e2 := NewEntry(k2, v2, DefaultMark, DefaultType)
 
 	err = df.Write(e1)
-	log.Println("e1.size: ", e1.Size())   //38
-	log.Println("df.offset: ", df.Offset) //38
+	log.Println("e1.size: ", e1.Size())   //62
+	log.Println("df.offset: ", df.Offset) //62
 
 	err = df.Write(e2)
-	log.Println("e1.size: ", e1.Size())   //38
-	log.Println("df.offset: ", df.Offset) //76
+	log.Println("e1.size: ", e1.Size())   //62
+	log.Println("df.offset: ", df.Offset) //124
 
 	if err != nil {
 		t.Error("Write Data Error: ", err)
@@ -87,7 +91,7 @@ func TestDBFile_WriteAndRead(t *testing.T) {
 		t.Error("e3 Read Data Error: ", err)
 	}
 
-	e4, err := df.Read(38)
+	e4, err := df.Read(e1.Size())
 	log.Printf("e4 key: %s, value: %s\n", string(e4.Meta.Key), string(e4.Meta.Value))
 	if err != nil {
 		t.Error("e4 Read Data Error: ", err)
@@ -106,3 +110,156 @@ func TestDBFile_WriteAndRead(t *testing.T) {
 		os.RemoveAll("./TmpFile")
 	}()
 }
+
+func TestDBFile_ReadInvalidCrc32(t *testing.T) {
+	dirPath := t.TempDir()
+	df, err := NewDBFile(dirPath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer df.Close()
+
+	e := NewEntry([]byte("test_key"), []byte("test_value"), DefaultMark, DefaultType)
+	if err := df.Write(e); err != nil {
+		t.Fatal("Write Data Error: ", err)
+	}
+
+	file, err := os.OpenFile(DataFileName(dirPath, 0), os.O_WRONLY, DefaultFilePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteAt([]byte("X"), e.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	if _, err := df.Read(0); !errors.Is(err, ErrInvalidCrc32) {
+		t.Errorf("Expected ErrInvalidCrc32, got %v", err)
+	}
+	if _, err := df.ReadSized(0, e.Size()); !errors.Is(err, ErrInvalidCrc32) {
+		t.Errorf("Expected ErrInvalidCrc32, got %v", err)
+	}
+}
+
+func TestDBFile_ReadSized(t *testing.T) {
+	df, err := NewDBFile(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer df.Close()
+
+	e1 := NewEntry([]byte("test_key_1"), []byte("test_value_1"), DefaultMark, DefaultType)
+	e2 := NewEntry([]byte("test_key_2"), nil, Delete, DefaultType)
+	if err := df.Write(e1); err != nil {
+		t.Fatal("Write Data Error: ", err)
+	}
+	if err := df.Write(e2); err != nil {
+		t.Fatal("Write Data Error: ", err)
+	}
+
+	e, err := df.ReadSized(0, e1.Size())
+	if err != nil || string(e.Meta.Key) != "test_key_1" || string(e.Meta.Value) != "test_value_1" {
+		t.Fatalf("Expected test_key_1, got %+v, err: %v", e, err)
+	}
+	e, err = df.ReadSized(e1.Size(), e2.Size())
+	if err != nil || string(e.Meta.Key) != "test_key_2" || e.Meta.Value != nil || e.Mark != Delete {
+		t.Fatalf("Expected the test_key_2 tombstone, got %+v, err: %v", e, err)
+	}
+
+	// a size that does not match the entry, or runs past the end of the file
+	var ce *CorruptionError
+	for _, size := range []int64{e1.Size() - 1, e1.Size() + 1, entryHeaderSize - 1, df.Offset + 1} {
+		if _, err := df.ReadSized(0, size); !errors.As(err, &ce) {
+			t.Errorf("Expected a CorruptionError for size %d, got %v", size, err)
+		}
+	}
+}
+
+func TestDBFile_EntryReader(t *testing.T) {
+	df, err := NewDBFile(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer df.Close()
+
+	var entries []*Entry
+	for i := 0; i < 1000; i++ {
+		e := NewEntry([]byte(fmt.Sprintf("test_key_%d", i)), bytes.Repeat([]byte("v"), i), DefaultMark, DefaultType)
+		if err := df.Write(e); err != nil {
+			t.Fatal("Write Data Error: ", err)
+		}
+		entries = append(entries, e)
+	}
+
+	er := df.newEntryReader()
+	for i, want := range entries {
+		e, err := er.Next()
+		if err != nil || !bytes.Equal(e.Meta.Key, want.Meta.Key) || !bytes.Equal(e.Meta.Value, want.Meta.Value) {
+			t.Fatalf("Expected entry %d to be %s, got %+v, err: %v", i, want.Meta.Key, e, err)
+		}
+	}
+	if _, err := er.Next(); err != io.EOF {
+		t.Fatalf("Expected io.EOF at the end of the file, got %v", err)
+	}
+
+	// an entry cut off at the end of the file
+	if err := df.Truncate(df.Offset - 1); err != nil {
+		t.Fatal(err)
+	}
+	er = df.newEntryReader()
+	for err == nil {
+		_, err = er.Next()
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("Expected io.ErrUnexpectedEOF for the cut off entry, got %v", err)
+	}
+}
+
+func benchmarkDBFileRead(b *testing.B, read func(df *DBFile, offset, size int64) (*Entry, error)) {
+	df, err := NewDBFile(b.TempDir(), 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer df.Close()
+
+	e := NewEntry([]byte("test_key"), make([]byte, 256), DefaultMark, DefaultType)
+	for i := 0; i < 1000; i++ {
+		if err := df.Write(e); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := read(df, int64(i%1000)*e.Size(), e.Size()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDBFile_Read(b *testing.B) {
+	benchmarkDBFileRead(b, func(df *DBFile, offset, _ int64) (*Entry, error) {
+		return df.Read(offset)
+	})
+}
+
+func BenchmarkDBFile_ReadSized(b *testing.B) {
+	benchmarkDBFileRead(b, (*DBFile).ReadSized)
+}
+
+func BenchmarkDBFile_Write(b *testing.B) {
+	df, err := NewDBFile(b.TempDir(), 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer df.Close()
+
+	e := NewEntry([]byte("test_key"), []byte("test_value"), DefaultMark, DefaultType)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := df.Write(e); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,17 +1,18 @@
 package TinyBitcaskDBV3
 
 import (
+	"errors"
 	"log"
 	"math/rand"
+	"os"
 	"strconv"
 	"testing"
 	"time"
 )
 
 const (
-	DefaultDataType = String
-	TestNum         = 100
-	TestMod         = 5
+	TestNum = 100
+	TestMod = 5
 )
 
 func TestInit(t *testing.T) {
@@ -19,18 +20,20 @@ func TestInit(t *testing.T) {
 }
 
 func TestOpen(t *testing.T) {
-	db, err := Open(DirPath, DefaultDataType)
+	db, err := Open(DirPath)
 	if err != nil {
 		t.Error(err)
 	}
+	defer db.Close()
 	t.Log(db)
 }
 
 func TestTinyDB_Put(t *testing.T) {
-	db, err := Open(DirPath, DefaultDataType)
+	db, err := Open(DirPath)
 	if err != nil {
 		t.Error(err)
 	}
+	defer db.Close()
 
 	rand.Seed(time.Now().UnixNano())
 	keyPrefix := "test_key_"
@@ -47,14 +50,17 @@ func TestTinyDB_Put(t *testing.T) {
 }
 
 func TestTinyDB_Get(t *testing.T) {
-	db, err := Open(DirPath, DefaultDataType)
+	db, err := Open(DirPath)
 	if err != nil {
 		t.Error(err)
 	}
+	defer db.Close()
 
 	getVal := func(key []byte) {
 		val, err := db.Get(key)
-		if err != nil {
+		if err == ErrKeyNotFound {
+			t.Logf("key = %s not found\n", string(key))
+		} else if err != nil {
 			t.Error("Get err: ", err)
 		} else {
 			t.Logf("key = %s, val = %s\n", string(key), string(val))
@@ -67,13 +73,18 @@ func TestTinyDB_Get(t *testing.T) {
 	getVal([]byte("test_key_3"))
 	getVal([]byte("test_key_4"))
 	getVal([]byte("test_key_5"))
+
+	if _, err := db.Get([]byte("test_key_never_put")); err != ErrKeyNotFound {
+		t.Error("Expected ErrKeyNotFound, got ", err)
+	}
 }
 
 func TestTinyDB_Del(t *testing.T) {
-	db, err := Open(DirPath, DefaultDataType)
+	db, err := Open(DirPath)
 	if err != nil {
 		t.Error(err)
 	}
+	defer db.Close()
 
 	key := []byte("test_key_101")
 	err = db.Del(key)
@@ -84,13 +95,365 @@ func TestTinyDB_Del(t *testing.T) {
 }
 
 func TestTinyDB_Merge(t *testing.T) {
-	db, err := Open(DirPath, DefaultDataType)
+	db, err := Open(DirPath)
 	if err != nil {
 		t.Error(err)
 	}
+	defer db.Close()
 
 	err = db.Merge()
 	if err != nil {
 		t.Error("merge err: ", err)
 	}
 }
+
+func TestTinyDB_Rotate(t *testing.T) {
+	dirPath := t.TempDir()
+	db, err := Open(dirPath, WithMaxFileSize(128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { db.Close() }()
+
+	for i := 0; i < TestNum; i++ {
+		key := []byte("rotate_key_" + strconv.Itoa(i))
+		if err := db.Put(key, []byte("rotate_value_"+strconv.Itoa(i))); err != nil {
+			t.Fatal("Put err: ", err)
+		}
+	}
+
+	fids, err := ListDataFileIDs(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fids) < 2 {
+		t.Fatalf("Expected several data files, got %d", len(fids))
+	}
+
+	db.Close()
+	db, err = Open(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < TestNum; i++ {
+		key := []byte("rotate_key_" + strconv.Itoa(i))
+		if v, err := db.Get(key); err != nil || string(v) != "rotate_value_"+strconv.Itoa(i) {
+			t.Fatalf("Expected %s=rotate_value_%d, got %s instead, err: %v", key, i, string(v), err)
+		}
+	}
+
+	if err := db.Merge(); err != nil {
+		t.Fatal("merge err: ", err)
+	}
+
+	for i := 0; i < TestNum; i++ {
+		key := []byte("rotate_key_" + strconv.Itoa(i))
+		if v, err := db.Get(key); err != nil || string(v) != "rotate_value_"+strconv.Itoa(i) {
+			t.Fatalf("Expected %s=rotate_value_%d after merge, got %s instead, err: %v", key, i, string(v), err)
+		}
+	}
+}
+
+func TestTinyDB_LoadFromHint(t *testing.T) {
+	dirPath := t.TempDir()
+	db, err := Open(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { db.Close() }()
+
+	for i := 0; i < TestNum; i++ {
+		key := []byte("hint_key_" + strconv.Itoa(i%TestMod))
+		if err := db.Put(key, []byte("hint_value_"+strconv.Itoa(i))); err != nil {
+			t.Fatal("Put err: ", err)
+		}
+	}
+
+	if err := db.Merge(); err != nil {
+		t.Fatal("merge err: ", err)
+	}
+	if _, err := os.Stat(HintFileName(dirPath, 0)); err != nil {
+		t.Fatal("hint file missing: ", err)
+	}
+
+	check := func(db *TinyDB) {
+		for i := TestNum - TestMod; i < TestNum; i++ {
+			key := []byte("hint_key_" + strconv.Itoa(i%TestMod))
+			if v, err := db.Get(key); err != nil || string(v) != "hint_value_"+strconv.Itoa(i) {
+				t.Fatalf("Expected %s=hint_value_%d, got %s instead, err: %v", key, i, string(v), err)
+			}
+		}
+	}
+
+	db.Close()
+	db, err = Open(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+
+	// a corrupted hint file falls back to scanning the data file
+	if err := os.WriteFile(HintFileName(dirPath, 0), []byte("garbage hint"), DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	db, err = Open(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+}
+
+func TestTinyDB_Close(t *testing.T) {
+	dirPath := t.TempDir()
+	db, err := Open(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { db.Close() }()
+
+	if err := db.Put([]byte("close_key"), []byte("close_value")); err != nil {
+		t.Fatal("Put err: ", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal("Close err: ", err)
+	}
+
+	if err := db.Put([]byte("close_key"), []byte("other")); err != ErrDBClosed {
+		t.Errorf("Expected ErrDBClosed from Put, got %v", err)
+	}
+	if _, err := db.Get([]byte("close_key")); err != ErrDBClosed {
+		t.Errorf("Expected ErrDBClosed from Get, got %v", err)
+	}
+	if err := db.Del([]byte("close_key")); err != ErrDBClosed {
+		t.Errorf("Expected ErrDBClosed from Del, got %v", err)
+	}
+	if _, err := db.Begin(); err != ErrDBClosed {
+		t.Errorf("Expected ErrDBClosed from Begin, got %v", err)
+	}
+	if err := db.Merge(); err != ErrDBClosed {
+		t.Errorf("Expected ErrDBClosed from Merge, got %v", err)
+	}
+	if err := db.Close(); err != ErrDBClosed {
+		t.Errorf("Expected ErrDBClosed from second Close, got %v", err)
+	}
+
+	db.Close()
+	db, err = Open(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v, err := db.Get([]byte("close_key")); err != nil || string(v) != "close_value" {
+		t.Fatalf("Expected close_key=close_value, got %s instead, err: %v", string(v), err)
+	}
+}
+
+func TestTinyDB_GetInvalidCrc32(t *testing.T) {
+	dirPath := t.TempDir()
+	db, err := Open(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Put([]byte("crc_key"), []byte("crc_value")); err != nil {
+		t.Fatal("Put err: ", err)
+	}
+	file, err := os.OpenFile(DataFileName(dirPath, 0), os.O_WRONLY, DefaultFilePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteAt([]byte("X"), entryHeaderSize); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	_, err = db.Get([]byte("crc_key"))
+	if !errors.Is(err, ErrInvalidCrc32) || !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("Expected ErrInvalidCrc32 and ErrCorrupted, got %v", err)
+	}
+
+	var cerr *CorruptionError
+	if !errors.As(err, &cerr) || cerr.FileID != 0 || cerr.Offset != 0 {
+		t.Errorf("Expected CorruptionError at file 0 offset 0, got %v", err)
+	}
+}
+
+func TestTinyDB_RecoverTornWrite(t *testing.T) {
+	dirPath := t.TempDir()
+	db, err := Open(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("torn_key_1"), []byte("torn_value_1")); err != nil {
+		t.Fatal("Put err: ", err)
+	}
+	db.Close()
+
+	// a crash in the middle of appending the second entry
+	e := NewEntry([]byte("torn_key_2"), []byte("torn_value_2"), Put, String)
+	enc, _ := e.Encode()
+	file, err := os.OpenFile(DataFileName(dirPath, 0), os.O_WRONLY|os.O_APPEND, DefaultFilePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(enc[:len(enc)-3])
+	file.Close()
+
+	if _, err := Open(dirPath, WithTruncateTornWrites(false)); err == nil {
+		t.Fatal("Expected Open to fail on a torn write")
+	}
+
+	db, err = Open(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("torn_key_3"), []byte("torn_value_3")); err != nil {
+		t.Fatal("Put err: ", err)
+	}
+	db.Close()
+
+	db, err = Open(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v, err := db.Get([]byte("torn_key_1")); err != nil || string(v) != "torn_value_1" {
+		t.Fatalf("Expected torn_key_1=torn_value_1, got %s instead, err: %v", string(v), err)
+	}
+	if v, err := db.Get([]byte("torn_key_2")); err != ErrKeyNotFound {
+		t.Fatalf("Expected torn_key_2 to be dropped, got %s instead, err: %v", string(v), err)
+	}
+	if v, err := db.Get([]byte("torn_key_3")); err != nil || string(v) != "torn_value_3" {
+		t.Fatalf("Expected torn_key_3=torn_value_3, got %s instead, err: %v", string(v), err)
+	}
+}
+
+func TestTinyDB_RecoverTornBatch(t *testing.T) {
+	dirPath := t.TempDir()
+	db, err := Open(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("a"), []byte("value_a")); err != nil {
+		t.Fatal("Put err: ", err)
+	}
+	wb := db.NewWriteBatch()
+	wb.Put([]byte("batch_key_1"), []byte("batch_value_1"))
+	wb.Put([]byte("batch_key_2"), []byte("batch_value_2"))
+	if err := wb.Commit(); err != nil {
+		t.Fatal("Commit err: ", err)
+	}
+	db.Close()
+
+	// the crash loses the end of the batch append, which covers the marker
+	// and more than one entry
+	file, err := os.OpenFile(DataFileName(dirPath, 0), os.O_RDWR, DefaultFilePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat, _ := file.Stat()
+	if _, err := file.WriteAt(make([]byte, 100), stat.Size()-100); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	db, err = Open(dirPath)
+	if err != nil {
+		t.Fatal("Open err: ", err)
+	}
+	defer db.Close()
+	if v, err := db.Get([]byte("a")); err != nil || string(v) != "value_a" {
+		t.Fatalf("Expected a=value_a, got %s instead, err: %v", string(v), err)
+	}
+	for _, key := range []string{"batch_key_1", "batch_key_2"} {
+		if _, err := db.Get([]byte(key)); err != ErrKeyNotFound {
+			t.Fatalf("Expected %s of the torn batch to be dropped, got %v", key, err)
+		}
+	}
+	if err := db.Put([]byte("b"), []byte("value_b")); err != nil {
+		t.Fatal("Put err: ", err)
+	}
+}
+
+func TestTinyDB_CorruptionBeforeCommitted(t *testing.T) {
+	dirPath := t.TempDir()
+	db, err := Open(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put([]byte("a"), []byte("value_a"))
+	db.Put([]byte("b"), []byte("value_b"))
+	db.Close()
+
+	// a committed entry follows the damaged one, this is no torn write
+	file, err := os.OpenFile(DataFileName(dirPath, 0), os.O_WRONLY, DefaultFilePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteAt([]byte("X"), entryHeaderSize); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	if _, err := Open(dirPath); !errors.Is(err, ErrInvalidCrc32) {
+		t.Fatalf("Expected Open to fail with ErrInvalidCrc32, got %v", err)
+	}
+}
+
+func TestTinyDB_DelTombstone(t *testing.T) {
+	dirPath := t.TempDir()
+	db, err := Open(dirPath, WithMaxFileSize(128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { db.Close() }()
+
+	for i := 0; i < TestNum; i++ {
+		key := []byte("del_key_" + strconv.Itoa(i))
+		if err := db.Put(key, []byte("del_value_"+strconv.Itoa(i))); err != nil {
+			t.Fatal("Put err: ", err)
+		}
+	}
+	for i := 0; i < TestNum; i += 2 {
+		if err := db.Del([]byte("del_key_" + strconv.Itoa(i))); err != nil {
+			t.Fatal("Del err: ", err)
+		}
+	}
+
+	check := func(db *TinyDB) {
+		for i := 0; i < TestNum; i++ {
+			key := []byte("del_key_" + strconv.Itoa(i))
+			v, err := db.Get(key)
+			if i%2 == 0 && err != ErrKeyNotFound {
+				t.Fatalf("Expected %s to be deleted, got %s instead, err: %v", key, string(v), err)
+			}
+			if i%2 == 1 && (err != nil || string(v) != "del_value_"+strconv.Itoa(i)) {
+				t.Fatalf("Expected %s=del_value_%d, got %s instead, err: %v", key, i, string(v), err)
+			}
+		}
+	}
+
+	check(db)
+	db.Close()
+	if db, err = Open(dirPath, WithMaxFileSize(128)); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+
+	if err := db.Merge(); err != nil {
+		t.Fatal("merge err: ", err)
+	}
+	if stats := db.Stats(); stats.Keys != TestNum/2 || stats.DeadBytes != 0 {
+		t.Fatalf("Expected merge to drop deleted entries and tombstones, got %+v", stats)
+	}
+	check(db)
+
+	db.Close()
+	if db, err = Open(dirPath, WithMaxFileSize(128)); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+}
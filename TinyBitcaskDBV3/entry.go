@@ -4,9 +4,10 @@ import (
 	"encoding/binary"
 	"errors"
 	"hash/crc32"
+	"sync"
 )
 
-const entryHeaderSize = 16
+const entryHeaderSize = 40
 
 // Type
 const (
@@ -21,6 +22,7 @@ const (
 const (
 	Put uint16 = iota
 	Delete
+	BatchCommit // commit marker of a WriteBatch, the value holds the entry count
 )
 
 var (
@@ -28,16 +30,19 @@ var (
 )
 
 type meta struct {
-	KeySize   uint32 // 8 -> 12
-	ValueSize uint32 // 12 -> 16
-	Key       []byte // 16 -> 16 + ks
-	Value     []byte // 16 + ks -> 16 + ks + vs
+	KeySize   uint32 // 32 -> 36
+	ValueSize uint32 // 36 -> 40
+	Key       []byte // 40 -> 40 + ks
+	Value     []byte // 40 + ks -> 40 + ks + vs
 }
 type Entry struct {
-	Crc  uint32 // 0 -> 4
-	Type uint16 // 4 -> 6
-	Mark uint16 // 6 -> 8
-	Meta meta
+	Crc       uint32 // 0 -> 4
+	Type      uint16 // 4 -> 6
+	Mark      uint16 // 6 -> 8
+	ExpiresAt int64  // 8 -> 16, unix nanoseconds, 0 never expires
+	BatchID   uint64 // 16 -> 24, 0 outside of a WriteBatch
+	Seq       uint64 // 24 -> 32, commit sequence number
+	Meta      meta
 }
 
 func NewEntry(key, value []byte, mark, dType uint16) *Entry {
@@ -53,6 +58,11 @@ func NewEntry(key, value []byte, mark, dType uint16) *Entry {
 	}
 }
 
+// expired reports whether the entry has a TTL that ran out before now
+func (e *Entry) expired(now int64) bool {
+	return e.ExpiresAt > 0 && e.ExpiresAt <= now
+}
+
 func (e *Entry) Size() int64 {
 	return int64(entryHeaderSize + e.Meta.KeySize + e.Meta.ValueSize)
 }
@@ -61,35 +71,70 @@ func (e *Entry) Encode() ([]byte, error) {
 	if e == nil || e.Meta.Key == nil {
 		return nil, ErrInvalidEntry
 	}
+	return e.AppendEncode(make([]byte, 0, e.Size()))
+}
+
+// AppendEncode appends the encoded entry to buf and returns the extended
+// buffer, it only allocates if buf is too small
+func (e *Entry) AppendEncode(buf []byte) ([]byte, error) {
+	if e == nil || e.Meta.Key == nil {
+		return buf, ErrInvalidEntry
+	}
 
-	buf := make([]byte, e.Size())
+	start := len(buf)
+	buf = grow(buf, int(e.Size()))
+	b := buf[start:]
 
-	binary.BigEndian.PutUint16(buf[4:6], e.Type)
-	binary.BigEndian.PutUint16(buf[6:8], e.Mark)
-	binary.BigEndian.PutUint32(buf[8:12], e.Meta.KeySize)
-	binary.BigEndian.PutUint32(buf[12:16], e.Meta.ValueSize)
+	binary.BigEndian.PutUint16(b[4:6], e.Type)
+	binary.BigEndian.PutUint16(b[6:8], e.Mark)
+	binary.BigEndian.PutUint64(b[8:16], uint64(e.ExpiresAt))
+	binary.BigEndian.PutUint64(b[16:24], e.BatchID)
+	binary.BigEndian.PutUint64(b[24:32], e.Seq)
+	binary.BigEndian.PutUint32(b[32:36], e.Meta.KeySize)
+	binary.BigEndian.PutUint32(b[36:40], e.Meta.ValueSize)
 
 	ks, vs := e.Meta.KeySize, e.Meta.ValueSize
-	copy(buf[entryHeaderSize:entryHeaderSize+ks], e.Meta.Key)
-	copy(buf[entryHeaderSize+ks:entryHeaderSize+ks+vs], e.Meta.Value)
+	copy(b[entryHeaderSize:entryHeaderSize+ks], e.Meta.Key)
+	copy(b[entryHeaderSize+ks:entryHeaderSize+ks+vs], e.Meta.Value)
 
-	crc := crc32.ChecksumIEEE(buf[4:])
-	binary.BigEndian.PutUint32(buf[0:4], crc)
+	crc := crc32.ChecksumIEEE(b[4:])
+	binary.BigEndian.PutUint32(b[0:4], crc)
 
 	return buf, nil
 }
 
+// grow extends buf by n bytes
+func grow(buf []byte, n int) []byte {
+	if len(buf)+n <= cap(buf) {
+		return buf[:len(buf)+n]
+	}
+	nbuf := make([]byte, len(buf)+n, 2*cap(buf)+n)
+	copy(nbuf, buf)
+	return nbuf
+}
+
+// encodePool recycles the buffers of one-off encodes such as DBFile.Write
+var encodePool = sync.Pool{
+	New: func() interface{} { return new([]byte) },
+}
+
 func Decode(buf []byte) (*Entry, error) {
 	crc := binary.BigEndian.Uint32(buf[0:4])
 	ty := binary.BigEndian.Uint16(buf[4:6])
 	mk := binary.BigEndian.Uint16(buf[6:8])
-	ks := binary.BigEndian.Uint32(buf[8:12])
-	vs := binary.BigEndian.Uint32(buf[12:16])
+	ex := int64(binary.BigEndian.Uint64(buf[8:16]))
+	id := binary.BigEndian.Uint64(buf[16:24])
+	sq := binary.BigEndian.Uint64(buf[24:32])
+	ks := binary.BigEndian.Uint32(buf[32:36])
+	vs := binary.BigEndian.Uint32(buf[36:40])
 
 	return &Entry{
-		Crc:  crc,
-		Type: ty,
-		Mark: mk,
+		Crc:       crc,
+		Type:      ty,
+		Mark:      mk,
+		ExpiresAt: ex,
+		BatchID:   id,
+		Seq:       sq,
 		Meta: meta{
 			KeySize:   ks,
 			ValueSize: vs,
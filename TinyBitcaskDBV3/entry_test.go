@@ -46,4 +46,38 @@ func BenchmarkEncode(b *testing.B) {
 			b.Error("Encode Error: ", err)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestAppendEncode(t *testing.T) {
+	key, value := []byte("test_key"), []byte("test_value")
+	e := NewEntry(key, value, Put, String)
+	enc, err := e.Encode()
+	if err != nil {
+		t.Fatal("Encode Error: ", err)
+	}
+
+	buf, err := e.AppendEncode([]byte("prefix"))
+	if err != nil {
+		t.Fatal("AppendEncode Error: ", err)
+	}
+	if string(buf[:6]) != "prefix" || string(buf[6:]) != string(enc) {
+		t.Error("AppendEncode differs from Encode")
+	}
+
+	if _, err := NewEntry(nil, value, Put, String).AppendEncode(nil); err != ErrInvalidEntry {
+		t.Errorf("Expected ErrInvalidEntry, got %v", err)
+	}
+}
+
+func BenchmarkAppendEncode(b *testing.B) {
+	b.ReportAllocs()
+	key, value := []byte("test_key"), []byte("test_value")
+	var buf []byte
+	for i := 0; i < b.N; i++ {
+		e1 := NewEntry(key, value, Put, String)
+		var err error
+		if buf, err = e1.AppendEncode(buf[:0]); err != nil {
+			b.Error("Encode Error: ", err)
+		}
+	}
+}
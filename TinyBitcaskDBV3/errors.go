@@ -0,0 +1,30 @@
+package TinyBitcaskDBV3
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrCorrupted = errors.New("data corrupted")
+)
+
+// CorruptionError reports where a data file is damaged. errors.Is matches it
+// against ErrCorrupted as well as the cause, e.g. ErrInvalidCrc32.
+type CorruptionError struct {
+	FileID uint32
+	Offset int64
+	Err    error
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("data file %d corrupted at offset %d: %v", e.FileID, e.Offset, e.Err)
+}
+
+func (e *CorruptionError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CorruptionError) Is(target error) bool {
+	return target == ErrCorrupted
+}
@@ -0,0 +1,193 @@
+package TinyBitcaskDBV3
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+var (
+	ErrNotInteger = errors.New("value is not an integer")
+	ErrOverflow   = errors.New("increment or decrement would overflow")
+)
+
+// hashKey is the record key of field of the hash at key
+func hashKey(key, field []byte) []byte {
+	return encodeSubKey(key, field)
+}
+
+// HSet sets field of the hash at key to value. Every field is a record of its
+// own, so a write never rewrites the rest of the hash.
+func (db *TinyDB) HSet(key, field, value []byte) error {
+	if err := db.checkMember(key, field, value); err != nil {
+		return err
+	}
+
+	return db.write(false, func() error {
+		return db.writeRecord(NewEntry(hashKey(key, field), value, Put, Hash))
+	})
+}
+
+// HGet returns the value of field of the hash at key
+func (db *TinyDB) HGet(key, field []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+	if err := db.checkType(key, Hash); err != nil {
+		return nil, err
+	}
+	return db.readRecord(Hash, hashKey(key, field))
+}
+
+// HDel removes fields from the hash at key with a single batch and returns how
+// many of them existed
+func (db *TinyDB) HDel(key []byte, fields ...[]byte) (n int, err error) {
+	if err = db.checkWrite(key, nil); err != nil {
+		return
+	}
+
+	err = db.write(false, func() error {
+		if err := db.checkType(key, Hash); err != nil {
+			return err
+		}
+		members := db.hashes.members(key)
+		seen := make(map[string]bool, len(fields))
+		var entries []*Entry
+		for _, field := range fields {
+			if _, ok := members[string(field)]; !ok || seen[string(field)] {
+				continue
+			}
+			seen[string(field)] = true
+			entries = append(entries, NewEntry(hashKey(key, field), nil, Delete, Hash))
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		if err := db.writeRecords(entries); err != nil {
+			return err
+		}
+		n = len(entries)
+		return nil
+	})
+	return
+}
+
+// HExists reports whether the hash at key has field
+func (db *TinyDB) HExists(key, field []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, ErrEmptyKey
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return false, ErrDBClosed
+	}
+	if err := db.checkType(key, Hash); err != nil {
+		return false, err
+	}
+	_, ok := db.hashes.members(key)[string(field)]
+	return ok, nil
+}
+
+// HGetAll returns every field of the hash at key with its value
+func (db *TinyDB) HGetAll(key []byte) (map[string][]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+	if err := db.checkType(key, Hash); err != nil {
+		return nil, err
+	}
+
+	members := db.hashes.members(key)
+	all := make(map[string][]byte, len(members))
+	for field, pos := range members {
+		e, err := db.readEntry(pos)
+		if err != nil {
+			return nil, err
+		}
+		all[field] = e.Meta.Value
+	}
+	return all, nil
+}
+
+// HKeys returns the fields of the hash at key in ascending order
+func (db *TinyDB) HKeys(key []byte) ([][]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+	if err := db.checkType(key, Hash); err != nil {
+		return nil, err
+	}
+	return db.hashes.sortedMembers(key), nil
+}
+
+// HLen returns the number of fields of the hash at key
+func (db *TinyDB) HLen(key []byte) (int, error) {
+	if len(key) == 0 {
+		return 0, ErrEmptyKey
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return 0, ErrDBClosed
+	}
+	if err := db.checkType(key, Hash); err != nil {
+		return 0, err
+	}
+	return len(db.hashes.members(key)), nil
+}
+
+// HIncrBy adds incr to the integer stored in field of the hash at key and
+// returns the result, a missing field counts as 0
+func (db *TinyDB) HIncrBy(key, field []byte, incr int64) (n int64, err error) {
+	if err = db.checkMember(key, field, nil); err != nil {
+		return
+	}
+
+	err = db.write(false, func() error {
+		rk := hashKey(key, field)
+		value, err := db.readRecord(Hash, rk)
+		switch {
+		case err == ErrKeyNotFound:
+			n = 0
+		case err != nil:
+			return err
+		default:
+			if n, err = strconv.ParseInt(string(value), 10, 64); err != nil {
+				return ErrNotInteger
+			}
+		}
+
+		if (incr > 0 && n > math.MaxInt64-incr) || (incr < 0 && n < math.MinInt64-incr) {
+			return ErrOverflow
+		}
+		n += incr
+		return db.writeRecord(NewEntry(rk, []byte(strconv.FormatInt(n, 10)), Put, Hash))
+	})
+	return
+}
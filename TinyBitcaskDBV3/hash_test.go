@@ -0,0 +1,120 @@
+package TinyBitcaskDBV3
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	key := []byte("hash_key")
+	for _, f := range []string{"name", "city", "age"} {
+		if err := db.HSet(key, []byte(f), []byte(f+"_value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.HSet(key, []byte("city"), []byte("new_city")); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := db.HGet(key, []byte("city")); err != nil || string(v) != "new_city" {
+		t.Fatalf("Expected new_city, got %s, err: %v", v, err)
+	}
+	if _, err := db.HGet(key, []byte("missing")); err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+	if ok, err := db.HExists(key, []byte("name")); err != nil || !ok {
+		t.Fatalf("Expected name to exist, err: %v", err)
+	}
+	if n, err := db.HLen(key); err != nil || n != 3 {
+		t.Fatalf("Expected 3 fields, got %d, err: %v", n, err)
+	}
+	if fields, err := db.HKeys(key); err != nil || !reflect.DeepEqual(fields, listValues("age", "city", "name")) {
+		t.Fatalf("Expected the sorted fields, got %q, err: %v", fields, err)
+	}
+	all, err := db.HGetAll(key)
+	if err != nil || !reflect.DeepEqual(all, map[string][]byte{"name": []byte("name_value"), "city": []byte("new_city"), "age": []byte("age_value")}) {
+		t.Fatalf("Unexpected HGetAll %q, err: %v", all, err)
+	}
+
+	if n, err := db.HDel(key, []byte("name"), []byte("name"), []byte("missing")); err != nil || n != 1 {
+		t.Fatalf("Expected 1 field deleted, got %d, err: %v", n, err)
+	}
+	if ok, _ := db.HExists(key, []byte("name")); ok {
+		t.Fatal("Expected name to be deleted")
+	}
+
+	if n, err := db.HIncrBy(key, []byte("counter"), 5); err != nil || n != 5 {
+		t.Fatalf("Expected 5, got %d, err: %v", n, err)
+	}
+	if n, err := db.HIncrBy(key, []byte("counter"), -7); err != nil || n != -2 {
+		t.Fatalf("Expected -2, got %d, err: %v", n, err)
+	}
+	if _, err := db.HIncrBy(key, []byte("city"), 1); err != ErrNotInteger {
+		t.Fatalf("Expected ErrNotInteger, got %v", err)
+	}
+	db.HSet(key, []byte("max"), []byte(fmt.Sprint(int64(math.MaxInt64))))
+	if _, err := db.HIncrBy(key, []byte("max"), 1); err != ErrOverflow {
+		t.Fatalf("Expected ErrOverflow, got %v", err)
+	}
+
+	if n, err := db.HLen([]byte("missing_hash")); err != nil || n != 0 {
+		t.Fatalf("Expected an empty hash, got %d, err: %v", n, err)
+	}
+}
+
+func TestHash_Merge(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, WithMaxFileSize(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := []byte("merge_hash")
+	for i := 0; i < 50; i++ {
+		if err := db.HSet(key, []byte(fmt.Sprintf("field_%d", i%10)), []byte(fmt.Sprintf("value_%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.HDel(key, []byte("field_0"), []byte("field_1"))
+	db.Put(key, []byte("string_value"))
+
+	check := func(db *TinyDB) {
+		t.Helper()
+		if n, err := db.HLen(key); err != nil || n != 8 {
+			t.Fatalf("Expected 8 fields, got %d, err: %v", n, err)
+		}
+		for i := 2; i < 10; i++ {
+			if v, err := db.HGet(key, []byte(fmt.Sprintf("field_%d", i))); err != nil || string(v) != fmt.Sprintf("value_%d", 40+i) {
+				t.Fatalf("Expected value_%d, got %s, err: %v", 40+i, v, err)
+			}
+		}
+		if v, err := db.Get(key); err != nil || string(v) != "string_value" {
+			t.Fatalf("Expected string_value, got %s, err: %v", v, err)
+		}
+	}
+
+	check(db)
+	before := db.Stats()
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+	if after := db.Stats(); after.DeadBytes != 0 || after.TotalBytes >= before.TotalBytes {
+		t.Fatalf("Expected the merge to drop the overwritten fields, got %+v before and %+v after", before, after)
+	}
+
+	db.Close()
+	if db, err = Open(dir, WithMaxFileSize(512)); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(db)
+}
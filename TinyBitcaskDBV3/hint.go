@@ -0,0 +1,169 @@
+package TinyBitcaskDBV3
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	HintFileSuffix = ".hint"
+)
+
+const hintHeaderSize = 48
+
+// Hint is the compact form of an entry written by Merge, it keeps
+// everything needed to rebuild the index without the value
+type Hint struct {
+	Crc       uint32 // 0 -> 4
+	Type      uint16 // 4 -> 6
+	Mark      uint16 // 6 -> 8
+	KeySize   uint32 // 8 -> 12
+	FileID    uint32 // 12 -> 16
+	Offset    int64  // 16 -> 24
+	Size      int64  // 24 -> 32
+	ExpiresAt int64  // 32 -> 40
+	Seq       uint64 // 40 -> 48
+	Key       []byte // 48 -> 48 + ks
+}
+
+func NewHint(key []byte, mark, dType uint16, pos *Pos) *Hint {
+	return &Hint{
+		Type:      dType,
+		Mark:      mark,
+		KeySize:   uint32(len(key)),
+		FileID:    pos.FileID,
+		Offset:    pos.Offset,
+		Size:      pos.Size,
+		ExpiresAt: pos.ExpiresAt,
+		Seq:       pos.Seq,
+		Key:       key,
+	}
+}
+
+func (h *Hint) Pos() *Pos {
+	return &Pos{FileID: h.FileID, Offset: h.Offset, Size: h.Size, ExpiresAt: h.ExpiresAt, Seq: h.Seq}
+}
+
+func (h *Hint) Encode() []byte {
+	buf := make([]byte, hintHeaderSize+len(h.Key))
+
+	binary.BigEndian.PutUint16(buf[4:6], h.Type)
+	binary.BigEndian.PutUint16(buf[6:8], h.Mark)
+	binary.BigEndian.PutUint32(buf[8:12], h.KeySize)
+	binary.BigEndian.PutUint32(buf[12:16], h.FileID)
+	binary.BigEndian.PutUint64(buf[16:24], uint64(h.Offset))
+	binary.BigEndian.PutUint64(buf[24:32], uint64(h.Size))
+	binary.BigEndian.PutUint64(buf[32:40], uint64(h.ExpiresAt))
+	binary.BigEndian.PutUint64(buf[40:48], h.Seq)
+	copy(buf[hintHeaderSize:], h.Key)
+
+	binary.BigEndian.PutUint32(buf[0:4], crc32.ChecksumIEEE(buf[4:]))
+	return buf
+}
+
+func DecodeHint(buf []byte) *Hint {
+	return &Hint{
+		Crc:       binary.BigEndian.Uint32(buf[0:4]),
+		Type:      binary.BigEndian.Uint16(buf[4:6]),
+		Mark:      binary.BigEndian.Uint16(buf[6:8]),
+		KeySize:   binary.BigEndian.Uint32(buf[8:12]),
+		FileID:    binary.BigEndian.Uint32(buf[12:16]),
+		Offset:    int64(binary.BigEndian.Uint64(buf[16:24])),
+		Size:      int64(binary.BigEndian.Uint64(buf[24:32])),
+		ExpiresAt: int64(binary.BigEndian.Uint64(buf[32:40])),
+		Seq:       binary.BigEndian.Uint64(buf[40:48]),
+	}
+}
+
+// HintFile is the hint file that sits next to a merged data file
+type HintFile struct {
+	File   *os.File
+	FileID uint32
+	Offset int64
+}
+
+// HintFileName returns the name of the hint file for data file fid in path
+func HintFileName(path string, fid uint32) string {
+	return filepath.Join(path, fmt.Sprintf("%09d%s", fid, HintFileSuffix))
+}
+
+func NewHintFile(path string, fid uint32) (*HintFile, error) {
+	return OpenHintFile(path, fid, os.O_CREATE|os.O_RDWR|os.O_APPEND, DefaultFilePerm)
+}
+
+// OpenHintFile opens the hint file of data file fid in path with the given
+// flag and permission
+func OpenHintFile(path string, fid uint32, flag int, perm os.FileMode) (*HintFile, error) {
+	file, err := os.OpenFile(HintFileName(path, fid), flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &HintFile{File: file, FileID: fid, Offset: stat.Size()}, nil
+}
+
+func (hf *HintFile) Write(h *Hint) (err error) {
+	enc := h.Encode()
+	if _, err = hf.File.Write(enc); err != nil {
+		return
+	}
+	hf.Offset += int64(len(enc))
+	return
+}
+
+// ReadAll returns every hint in the file, a torn or corrupted record fails
+// the whole file so the caller can fall back to the data file
+func (hf *HintFile) ReadAll() ([]*Hint, error) {
+	var (
+		hints  []*Hint
+		offset int64
+	)
+
+	header := make([]byte, hintHeaderSize)
+	for {
+		if _, err := hf.File.ReadAt(header, offset); err != nil {
+			if err == io.EOF && offset == hf.Offset {
+				break
+			}
+			return nil, err
+		}
+
+		h := DecodeHint(header)
+		if offset+hintHeaderSize+int64(h.KeySize) > hf.Offset {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		buf := make([]byte, hintHeaderSize+int(h.KeySize))
+		if _, err := hf.File.ReadAt(buf, offset); err != nil {
+			return nil, err
+		}
+
+		if h.Crc != crc32.ChecksumIEEE(buf[4:]) {
+			return nil, ErrInvalidCrc32
+		}
+
+		h.Key = buf[hintHeaderSize:]
+		hints = append(hints, h)
+		offset += int64(len(buf))
+	}
+
+	return hints, nil
+}
+
+func (hf *HintFile) Close() error {
+	return hf.File.Close()
+}
+
+func (hf *HintFile) Sync() error {
+	return hf.File.Sync()
+}
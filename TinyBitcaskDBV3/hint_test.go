@@ -0,0 +1,65 @@
+package TinyBitcaskDBV3
+
+import (
+	"os"
+	"testing"
+)
+
+func TestHintFile_WriteAndReadAll(t *testing.T) {
+	dirPath := t.TempDir()
+	hf, err := NewHintFile(dirPath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hf.Close()
+
+	h1 := NewHint([]byte("test_key_1"), Put, String, &Pos{FileID: 0, Offset: 0, Size: 38})
+	h2 := NewHint([]byte("test_key_2"), Put, String, &Pos{FileID: 0, Offset: 38, Size: 38})
+	if err := hf.Write(h1); err != nil {
+		t.Fatal("Write Hint Error: ", err)
+	}
+	if err := hf.Write(h2); err != nil {
+		t.Fatal("Write Hint Error: ", err)
+	}
+
+	hints, err := hf.ReadAll()
+	if err != nil {
+		t.Fatal("ReadAll Error: ", err)
+	}
+	if len(hints) != 2 {
+		t.Fatalf("Expected 2 hints, got %d", len(hints))
+	}
+	if string(hints[1].Key) != "test_key_2" || hints[1].Offset != 38 || hints[1].Size != 38 {
+		t.Errorf("Read hint different: %+v", hints[1])
+	}
+}
+
+func TestHintFile_Corrupted(t *testing.T) {
+	dirPath := t.TempDir()
+	hf, err := NewHintFile(dirPath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hf.Write(NewHint([]byte("test_key"), Put, String, &Pos{Size: 38})); err != nil {
+		t.Fatal(err)
+	}
+	hf.Close()
+
+	file, err := os.OpenFile(HintFileName(dirPath, 0), os.O_WRONLY, DefaultFilePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteAt([]byte{0xff}, hintHeaderSize); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	if hf, err = NewHintFile(dirPath, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer hf.Close()
+
+	if _, err := hf.ReadAll(); err != ErrInvalidCrc32 {
+		t.Errorf("Expected ErrInvalidCrc32, got %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package TinyBitcaskDBV3
+
+import (
+	"bytes"
+	"sort"
+)
+
+// IndexType selects the in-memory index implementation
+type IndexType uint8
+
+const (
+	BTreeIndex IndexType = iota // ordered, good all round
+	HashIndex                   // fastest point lookups, iterators sort on creation
+	ARTIndex                    // adaptive radix tree, compact for keys sharing prefixes
+)
+
+// Indexer maps every live key to the position of its latest entry. It is not
+// safe for concurrent use, TinyDB guards it with db.mu.
+type Indexer interface {
+	// Put sets key to pos and returns the Pos it replaced
+	Put(key []byte, pos *Pos) (*Pos, bool)
+	Get(key []byte) (*Pos, bool)
+	// Delete removes key and returns its Pos
+	Delete(key []byte) (*Pos, bool)
+	// Iterator returns a snapshot of the keys in [start, end) in key order, a
+	// nil end is unbounded
+	Iterator(start, end []byte, reverse bool) IndexIterator
+	Size() int
+}
+
+// IndexIterator walks a snapshot of an Indexer in key order
+type IndexIterator interface {
+	Rewind()
+	// Seek moves to the first key >= key, or <= key in reverse
+	Seek(key []byte)
+	Next()
+	Valid() bool
+	Key() []byte
+	Pos() *Pos
+	Close()
+}
+
+func newIndexer(typ IndexType) Indexer {
+	switch typ {
+	case HashIndex:
+		return newHashIndex()
+	case ARTIndex:
+		return newARTIndex()
+	default:
+		return newBTreeIndex()
+	}
+}
+
+type indexItem struct {
+	key []byte
+	pos *Pos
+}
+
+// inRange reports whether key is in [start, end), a nil end is unbounded
+func inRange(key, start, end []byte) bool {
+	return bytes.Compare(key, start) >= 0 && (end == nil || bytes.Compare(key, end) < 0)
+}
+
+// sliceIterator is an IndexIterator over items sorted in ascending key order
+type sliceIterator struct {
+	items   []indexItem
+	reverse bool
+	index   int
+}
+
+func newSliceIterator(items []indexItem, reverse bool) *sliceIterator {
+	if reverse {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	return &sliceIterator{items: items, reverse: reverse}
+}
+
+func (it *sliceIterator) Rewind() {
+	it.index = 0
+}
+
+func (it *sliceIterator) Seek(key []byte) {
+	it.index = sort.Search(len(it.items), func(i int) bool {
+		if it.reverse {
+			return bytes.Compare(it.items[i].key, key) <= 0
+		}
+		return bytes.Compare(it.items[i].key, key) >= 0
+	})
+}
+
+func (it *sliceIterator) Next() {
+	if it.index < len(it.items) {
+		it.index++
+	}
+}
+
+func (it *sliceIterator) Valid() bool {
+	return it.index < len(it.items)
+}
+
+func (it *sliceIterator) Key() []byte {
+	return it.items[it.index].key
+}
+
+func (it *sliceIterator) Pos() *Pos {
+	return it.items[it.index].pos
+}
+
+func (it *sliceIterator) Close() {
+	it.items = nil
+}
+
+// hashIndex is an Indexer on top of a Go map
+type hashIndex struct {
+	m map[string]*Pos
+}
+
+func newHashIndex() *hashIndex {
+	return &hashIndex{m: make(map[string]*Pos)}
+}
+
+func (h *hashIndex) Put(key []byte, pos *Pos) (*Pos, bool) {
+	old, ok := h.m[string(key)]
+	h.m[string(key)] = pos
+	return old, ok
+}
+
+func (h *hashIndex) Get(key []byte) (*Pos, bool) {
+	pos, ok := h.m[string(key)]
+	return pos, ok
+}
+
+func (h *hashIndex) Delete(key []byte) (*Pos, bool) {
+	pos, ok := h.m[string(key)]
+	if ok {
+		delete(h.m, string(key))
+	}
+	return pos, ok
+}
+
+func (h *hashIndex) Iterator(start, end []byte, reverse bool) IndexIterator {
+	var items []indexItem
+	for key, pos := range h.m {
+		if inRange([]byte(key), start, end) {
+			items = append(items, indexItem{key: []byte(key), pos: pos})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return bytes.Compare(items[i].key, items[j].key) < 0 })
+	return newSliceIterator(items, reverse)
+}
+
+func (h *hashIndex) Size() int {
+	return len(h.m)
+}
+
+// btreeIndex is an Indexer on top of bTree
+type btreeIndex struct {
+	tree *bTree
+}
+
+func newBTreeIndex() *btreeIndex {
+	return &btreeIndex{tree: newBTree()}
+}
+
+func (b *btreeIndex) Put(key []byte, pos *Pos) (*Pos, bool) {
+	return b.tree.Put(string(key), pos)
+}
+
+func (b *btreeIndex) Get(key []byte) (*Pos, bool) {
+	return b.tree.Get(string(key))
+}
+
+func (b *btreeIndex) Delete(key []byte) (*Pos, bool) {
+	return b.tree.Delete(string(key))
+}
+
+// Iterator walks the tree from the bound it starts at, in reverse it collects
+// the items in descending order right away
+func (b *btreeIndex) Iterator(start, end []byte, reverse bool) IndexIterator {
+	var items []indexItem
+	if !reverse {
+		b.tree.Ascend(string(start), func(key string, pos *Pos) bool {
+			if end != nil && key >= string(end) {
+				return false
+			}
+			items = append(items, indexItem{key: []byte(key), pos: pos})
+			return true
+		})
+		return newSliceIterator(items, false)
+	}
+
+	fn := func(key string, pos *Pos) bool {
+		if key < string(start) {
+			return false
+		}
+		if end == nil || key != string(end) {
+			items = append(items, indexItem{key: []byte(key), pos: pos})
+		}
+		return true
+	}
+	if end == nil {
+		b.tree.Descend(fn)
+	} else {
+		b.tree.DescendLessOrEqual(string(end), fn)
+	}
+	return &sliceIterator{items: items, reverse: true}
+}
+
+func (b *btreeIndex) Size() int {
+	return b.tree.Len()
+}
@@ -0,0 +1,154 @@
+package TinyBitcaskDBV3
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+var indexTypes = map[string]IndexType{
+	"btree": BTreeIndex,
+	"hash":  HashIndex,
+	"art":   ARTIndex,
+}
+
+func TestIndexer_RandomOps(t *testing.T) {
+	for name, typ := range indexTypes {
+		t.Run(name, func(t *testing.T) {
+			index := newIndexer(typ)
+			expected := make(map[string]int64)
+
+			// short keys sharing prefixes and prefixes of each other exercise the
+			// node growth, shrinking and path compression of the radix tree
+			r := rand.New(rand.NewSource(1))
+			for i := 0; i < 30000; i++ {
+				key := "k" + strconv.Itoa(r.Intn(2000))
+				if r.Intn(3) == 0 {
+					_, ok := index.Delete([]byte(key))
+					if _, exist := expected[key]; ok != exist {
+						t.Fatalf("Delete %s returned %v, expected %v", key, ok, exist)
+					}
+					delete(expected, key)
+				} else {
+					old, ok := index.Put([]byte(key), &Pos{Offset: int64(i)})
+					if offset, exist := expected[key]; ok != exist || (ok && old.Offset != offset) {
+						t.Fatalf("Put %s returned %v %v, expected %v %d", key, old, ok, exist, offset)
+					}
+					expected[key] = int64(i)
+				}
+			}
+
+			if index.Size() != len(expected) {
+				t.Fatalf("Expected %d keys, got %d", len(expected), index.Size())
+			}
+
+			keys := make([]string, 0, len(expected))
+			for key, offset := range expected {
+				keys = append(keys, key)
+				if pos, ok := index.Get([]byte(key)); !ok || pos.Offset != offset {
+					t.Fatalf("Get %s returned %v, expected offset %d", key, pos, offset)
+				}
+			}
+			sort.Strings(keys)
+
+			it := index.Iterator(nil, nil, false)
+			for i := range keys {
+				if !it.Valid() || string(it.Key()) != keys[i] {
+					t.Fatalf("Iterator out of order at %d, expected %s", i, keys[i])
+				}
+				it.Next()
+			}
+			if it.Valid() {
+				t.Fatalf("Iterator returned more than %d keys", len(keys))
+			}
+			it.Close()
+
+			pivot := keys[len(keys)/2]
+			rit := index.Iterator(nil, nil, true)
+			rit.Seek([]byte(pivot + "\x00"))
+			if !rit.Valid() || string(rit.Key()) != pivot {
+				t.Fatalf("Reverse Seek expected %s", pivot)
+			}
+			rit.Close()
+
+			// keys sharing a prefix with the bounds but outside of them are left out
+			start, end := keys[len(keys)/4], keys[len(keys)/2]
+			for _, reverse := range []bool{false, true} {
+				bounded := keys[len(keys)/4 : len(keys)/2]
+				bit := index.Iterator([]byte(start), []byte(end), reverse)
+				for i := range bounded {
+					j := i
+					if reverse {
+						j = len(bounded) - 1 - i
+					}
+					if !bit.Valid() || string(bit.Key()) != bounded[j] {
+						t.Fatalf("Iterator [%s, %s) reverse %v out of order at %d, expected %s", start, end, reverse, i, bounded[j])
+					}
+					bit.Next()
+				}
+				if bit.Valid() {
+					t.Fatalf("Iterator [%s, %s) returned %s past its bounds", start, end, bit.Key())
+				}
+				bit.Close()
+			}
+
+			for _, key := range keys {
+				index.Delete([]byte(key))
+			}
+			if index.Size() != 0 || index.Iterator(nil, nil, false).Valid() {
+				t.Fatalf("Expected empty index, got %d keys", index.Size())
+			}
+		})
+	}
+}
+
+func TestTinyDB_IndexTypes(t *testing.T) {
+	for name, typ := range indexTypes {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := Open(dir, WithIndexType(typ), WithMaxFileSize(512))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < TestNum; i++ {
+				key := []byte(fmt.Sprintf("index_key_%03d", i))
+				if err := db.Put(key, []byte(fmt.Sprintf("index_value_%03d", i))); err != nil {
+					t.Fatal("Put err: ", err)
+				}
+				if i%2 == 0 {
+					if err := db.Del(key); err != nil {
+						t.Fatal("Del err: ", err)
+					}
+				}
+			}
+			if err := db.Merge(); err != nil {
+				t.Fatal("Merge err: ", err)
+			}
+			db.Close()
+
+			db, err = Open(dir, WithIndexType(typ))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			var keys []string
+			err = db.Scan([]byte("index_key_"), func(key, value []byte) bool {
+				keys = append(keys, string(key))
+				return true
+			})
+			if err != nil {
+				t.Fatal("Scan err: ", err)
+			}
+			if len(keys) != TestNum/2 || keys[0] != "index_key_001" {
+				t.Fatalf("Expected %d odd keys from index_key_001, got %d", TestNum/2, len(keys))
+			}
+			if _, err := db.Get([]byte("index_key_000")); err != ErrKeyNotFound {
+				t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package TinyBitcaskDBV3
+
+import (
+	"bytes"
+	"errors"
+	"time"
+)
+
+var (
+	ErrIteratorClosed = errors.New("iterator closed")
+)
+
+// IteratorOptions selects the keys an Iterator walks over
+type IteratorOptions struct {
+	Prefix  []byte // only keys starting with Prefix
+	Reverse bool   // walk from the largest key to the smallest
+}
+
+// Iterator walks the keys of a TinyDB in order. It sees the database as of
+// NewIterator, later Put and Del calls are not visible to it and keys that
+// had expired by then are skipped. The data files
+// it reads from are kept open until Close, so close it as soon as possible.
+type Iterator struct {
+	db     *TinyDB
+	iter   IndexIterator // keys in the bounds of the iterator
+	files  map[uint32]*DBFile
+	now    int64 // keys expired at this time are skipped
+	closed bool
+}
+
+// NewIterator returns an Iterator positioned at the first key
+func (db *TinyDB) NewIterator(opts IteratorOptions) (*Iterator, error) {
+	var end []byte
+	if len(opts.Prefix) > 0 {
+		end = prefixEnd(opts.Prefix)
+	}
+	return db.newIterator(opts.Prefix, end, opts.Reverse)
+}
+
+// newIterator snapshots the keys in [start, end), a nil end is unbounded.
+// Writers wait while the keys in the range are copied.
+func (db *TinyDB) newIterator(start, end []byte, reverse bool) (*Iterator, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+
+	it := &Iterator{
+		db:    db,
+		iter:  db.indexes.Iterator(start, end, reverse),
+		files: make(map[uint32]*DBFile, len(db.olderFiles)+1),
+		now:   time.Now().UnixNano(),
+	}
+	it.Rewind()
+
+	for fid, dbFile := range db.olderFiles {
+		it.files[fid] = dbFile
+	}
+	it.files[db.activeFile.FileID] = db.activeFile
+
+	db.iterators++
+	return it, nil
+}
+
+// Rewind moves the iterator back to the first key
+func (it *Iterator) Rewind() {
+	if it.closed {
+		return
+	}
+
+	it.iter.Rewind()
+	it.skipExpired()
+}
+
+// Seek moves the iterator to the first key >= key, or <= key in reverse
+func (it *Iterator) Seek(key []byte) {
+	if it.closed {
+		return
+	}
+
+	it.iter.Seek(key)
+	it.skipExpired()
+}
+
+func (it *Iterator) Next() {
+	if !it.closed {
+		it.iter.Next()
+		it.skipExpired()
+	}
+}
+
+func (it *Iterator) skipExpired() {
+	for it.iter.Valid() && it.iter.Pos().expired(it.now) {
+		it.iter.Next()
+	}
+}
+
+// Valid reports whether the iterator points at a key
+func (it *Iterator) Valid() bool {
+	return !it.closed && it.iter.Valid()
+}
+
+func (it *Iterator) Key() []byte {
+	if !it.Valid() {
+		return nil
+	}
+	return append([]byte(nil), it.iter.Key()...)
+}
+
+// Value reads the value of the current key from the data files
+func (it *Iterator) Value() ([]byte, error) {
+	if it.closed {
+		return nil, ErrIteratorClosed
+	}
+	if !it.Valid() {
+		return nil, ErrKeyNotFound
+	}
+
+	it.db.mu.RLock()
+	defer it.db.mu.RUnlock()
+
+	if it.db.closed {
+		return nil, ErrDBClosed
+	}
+
+	pos := it.iter.Pos()
+	e, err := it.files[pos.FileID].ReadSized(pos.Offset, pos.Size)
+	if err != nil {
+		return nil, err
+	}
+	return e.Meta.Value, nil
+}
+
+// Close releases the iterator, data files replaced by a merge while it was
+// open are closed once no iterator or transaction reads them any more
+func (it *Iterator) Close() error {
+	if it.closed {
+		return ErrIteratorClosed
+	}
+	it.closed = true
+	it.iter.Close()
+	it.files = nil
+
+	db := it.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.iterators--
+	return db.releaseRetired()
+}
+
+// Scan calls fn for every key with prefix in ascending order until fn returns
+// false
+func (db *TinyDB) Scan(prefix []byte, fn func(key, value []byte) bool) error {
+	it, err := db.NewIterator(IteratorOptions{Prefix: prefix})
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	return it.each(fn)
+}
+
+// Range calls fn for every key in [start, end) in ascending order until fn
+// returns false, a nil end means no upper bound
+func (db *TinyDB) Range(start, end []byte, fn func(key, value []byte) bool) error {
+	it, err := db.newIterator(start, end, false)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	return it.each(fn)
+}
+
+func (it *Iterator) each(fn func(key, value []byte) bool) error {
+	for ; it.Valid(); it.Next() {
+		value, err := it.Value()
+		if err != nil {
+			return err
+		}
+		if !fn(it.Key(), value) {
+			break
+		}
+	}
+	return nil
+}
+
+// prefixEnd returns the smallest key greater than every key with prefix, nil
+// if there is none
+func prefixEnd(prefix []byte) []byte {
+	end := bytes.TrimRight(prefix, "\xff")
+	if len(end) == 0 {
+		return nil
+	}
+
+	end = append([]byte(nil), end...)
+	end[len(end)-1]++
+	return end
+}
@@ -0,0 +1,131 @@
+package TinyBitcaskDBV3
+
+import (
+	"fmt"
+	"testing"
+)
+
+func newIteratorTestDB(t *testing.T) *TinyDB {
+	db, err := Open(t.TempDir(), WithMaxFileSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := TestNum - 1; i >= 0; i-- {
+		key := []byte(fmt.Sprintf("iter_key_%03d", i))
+		if err := db.Put(key, []byte(fmt.Sprintf("iter_value_%03d", i))); err != nil {
+			t.Fatal("Put err: ", err)
+		}
+	}
+	return db
+}
+
+func TestIterator_Order(t *testing.T) {
+	db := newIteratorTestDB(t)
+	defer db.Close()
+
+	it, err := db.NewIterator(IteratorOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := 0
+	for ; it.Valid(); it.Next() {
+		if string(it.Key()) != fmt.Sprintf("iter_key_%03d", i) {
+			t.Fatalf("Expected iter_key_%03d, got %s", i, it.Key())
+		}
+		if v, err := it.Value(); err != nil || string(v) != fmt.Sprintf("iter_value_%03d", i) {
+			t.Fatalf("Expected iter_value_%03d, got %s, err: %v", i, string(v), err)
+		}
+		i++
+	}
+	if i != TestNum {
+		t.Fatalf("Expected %d keys, got %d", TestNum, i)
+	}
+
+	it.Seek([]byte("iter_key_0505"))
+	if !it.Valid() || string(it.Key()) != "iter_key_051" {
+		t.Fatalf("Expected Seek to land on iter_key_051, got %s", it.Key())
+	}
+	it.Close()
+
+	rit, err := db.NewIterator(IteratorOptions{Reverse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rit.Close()
+	if !rit.Valid() || string(rit.Key()) != fmt.Sprintf("iter_key_%03d", TestNum-1) {
+		t.Fatalf("Expected reverse iterator to start at the last key, got %s", rit.Key())
+	}
+	rit.Seek([]byte("iter_key_0505"))
+	if !rit.Valid() || string(rit.Key()) != "iter_key_050" {
+		t.Fatalf("Expected reverse Seek to land on iter_key_050, got %s", rit.Key())
+	}
+}
+
+func TestIterator_Snapshot(t *testing.T) {
+	db := newIteratorTestDB(t)
+	defer db.Close()
+
+	it, err := db.NewIterator(IteratorOptions{Prefix: []byte("iter_key_00")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+
+	if err := db.Put([]byte("iter_key_000"), []byte("changed")); err != nil {
+		t.Fatal("Put err: ", err)
+	}
+	if err := db.Del([]byte("iter_key_001")); err != nil {
+		t.Fatal("Del err: ", err)
+	}
+	if err := db.Merge(); err != nil {
+		t.Fatal("merge err: ", err)
+	}
+
+	var keys []string
+	for ; it.Valid(); it.Next() {
+		v, err := it.Value()
+		if err != nil {
+			t.Fatal("Value err: ", err)
+		}
+		if string(v) != "iter_value_"+string(it.Key())[len("iter_key_"):] {
+			t.Fatalf("Expected the value as of NewIterator for %s, got %s", it.Key(), string(v))
+		}
+		keys = append(keys, string(it.Key()))
+	}
+	if len(keys) != 10 {
+		t.Fatalf("Expected 10 keys with prefix, got %v", keys)
+	}
+}
+
+func TestTinyDB_ScanAndRange(t *testing.T) {
+	db := newIteratorTestDB(t)
+	defer db.Close()
+
+	var scanned []string
+	err := db.Scan([]byte("iter_key_09"), func(key, value []byte) bool {
+		scanned = append(scanned, string(key))
+		return true
+	})
+	if err != nil || len(scanned) != 10 || scanned[0] != "iter_key_090" || scanned[9] != "iter_key_099" {
+		t.Fatalf("Unexpected Scan result %v, err: %v", scanned, err)
+	}
+
+	var ranged []string
+	err = db.Range([]byte("iter_key_010"), []byte("iter_key_015"), func(key, value []byte) bool {
+		ranged = append(ranged, string(key))
+		return true
+	})
+	if err != nil || len(ranged) != 5 || ranged[0] != "iter_key_010" || ranged[4] != "iter_key_014" {
+		t.Fatalf("Unexpected Range result %v, err: %v", ranged, err)
+	}
+
+	count := 0
+	err = db.Range(nil, nil, func(key, value []byte) bool {
+		count++
+		return count < 3
+	})
+	if err != nil || count != 3 {
+		t.Fatalf("Expected Range to stop after 3 keys, got %d, err: %v", count, err)
+	}
+}
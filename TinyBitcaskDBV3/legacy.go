@@ -0,0 +1,122 @@
+package TinyBitcaskDBV3
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// legacyHeaderSize is the entry header of the first format:
+// crc(4) | type(2) | mark(2) | ks(4) | vs(4), the crc covers everything after
+// itself up to the end of the value
+const legacyHeaderSize = 16
+
+// legacyValue is where the value of a live key sits in the legacy file
+type legacyValue struct {
+	offset int64
+	size   uint32
+}
+
+// migrateLegacy moves the keys of a data file of the first format into the
+// data files as String records and removes it. The legacy file only goes once
+// its keys are fsynced, a migration cut short starts over on the next Open.
+func (db *TinyDB) migrateLegacy() error {
+	path := filepath.Join(db.dirPath, LegacyFileName)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	keys, values, err := scanLegacy(file)
+	if err != nil {
+		return fmt.Errorf("migrate %s: %w", path, err)
+	}
+
+	err = db.write(true, func() error {
+		for _, key := range keys {
+			v := values[key]
+			value := make([]byte, v.size)
+			if _, err := file.ReadAt(value, v.offset); err != nil {
+				return err
+			}
+			if err := db.put([]byte(key), value, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("migrate %s: %w", path, err)
+	}
+
+	db.logf("migrated %d keys from %s\n", len(keys), path)
+	return os.Remove(path)
+}
+
+// scanLegacy replays the legacy file and returns its live keys in the order
+// they were first written. A cut off entry at the end is the torn tail of the
+// last write and ends the scan.
+func scanLegacy(file *os.File) (keys []string, values map[string]legacyValue, err error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values = make(map[string]legacyValue)
+	seen := make(map[string]bool)
+	r := bufio.NewReaderSize(file, 64<<10)
+	header := make([]byte, legacyHeaderSize)
+
+	var offset int64
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		mark := binary.BigEndian.Uint16(header[6:8])
+		ks := binary.BigEndian.Uint32(header[8:12])
+		vs := binary.BigEndian.Uint32(header[12:16])
+		size := legacyHeaderSize + int64(ks) + int64(vs)
+		if offset+size > stat.Size() {
+			break
+		}
+		body := make([]byte, size-legacyHeaderSize)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, nil, err
+		}
+
+		crc := crc32.ChecksumIEEE(header[4:])
+		if binary.BigEndian.Uint32(header[0:4]) != crc32.Update(crc, crc32.IEEETable, body) {
+			return nil, nil, fmt.Errorf("%w at offset %d", ErrInvalidCrc32, offset)
+		}
+
+		key := string(body[:ks])
+		if mark == Delete {
+			delete(values, key)
+		} else {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+			values[key] = legacyValue{offset: offset + legacyHeaderSize + int64(ks), size: vs}
+		}
+		offset += size
+	}
+
+	live := keys[:0]
+	for _, key := range keys {
+		if _, ok := values[key]; ok {
+			live = append(live, key)
+		}
+	}
+	return live, values, nil
+}
@@ -0,0 +1,92 @@
+package TinyBitcaskDBV3
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// encodeLegacy encodes an entry of the first format
+func encodeLegacy(key, value []byte, mark uint16) []byte {
+	buf := make([]byte, legacyHeaderSize+len(key)+len(value))
+	binary.BigEndian.PutUint16(buf[4:6], String)
+	binary.BigEndian.PutUint16(buf[6:8], mark)
+	binary.BigEndian.PutUint32(buf[8:12], uint32(len(key)))
+	binary.BigEndian.PutUint32(buf[12:16], uint32(len(value)))
+	copy(buf[legacyHeaderSize:], key)
+	copy(buf[legacyHeaderSize+len(key):], value)
+	binary.BigEndian.PutUint32(buf[0:4], crc32.ChecksumIEEE(buf[4:]))
+	return buf
+}
+
+func TestOpen_MigrateLegacyDataFile(t *testing.T) {
+	dir := t.TempDir()
+	var data []byte
+	data = append(data, encodeLegacy([]byte("legacy_key_1"), []byte("old_value"), Put)...)
+	data = append(data, encodeLegacy([]byte("legacy_key_2"), []byte("legacy_value_2"), Put)...)
+	data = append(data, encodeLegacy([]byte("legacy_key_1"), []byte("legacy_value_1"), Put)...)
+	data = append(data, encodeLegacy([]byte("legacy_key_3"), []byte("legacy_value_3"), Put)...)
+	data = append(data, encodeLegacy([]byte("legacy_key_3"), nil, Delete)...)
+	// a torn tail left by the last write
+	torn := encodeLegacy([]byte("legacy_key_4"), []byte("legacy_value_4"), Put)
+	data = append(data, torn[:len(torn)-3]...)
+	legacy := filepath.Join(dir, LegacyFileName)
+	if err := os.WriteFile(legacy, data, DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	// a read-only database cannot migrate it
+	if _, err := Open(dir, WithReadOnly(true)); !errors.Is(err, ErrLegacyDataFile) {
+		t.Fatalf("Expected ErrLegacyDataFile, got %v", err)
+	}
+
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Fatalf("Expected the legacy file to be removed, err: %v", err)
+	}
+
+	check := func(db *TinyDB) {
+		t.Helper()
+		for key, expected := range map[string]string{"legacy_key_1": "legacy_value_1", "legacy_key_2": "legacy_value_2"} {
+			if v, err := db.Get([]byte(key)); err != nil || string(v) != expected {
+				t.Fatalf("Expected %s=%s, got %s, err: %v", key, expected, v, err)
+			}
+		}
+		for _, key := range []string{"legacy_key_3", "legacy_key_4"} {
+			if _, err := db.Get([]byte(key)); err != ErrKeyNotFound {
+				t.Fatalf("Expected ErrKeyNotFound for %s, got %v", key, err)
+			}
+		}
+	}
+
+	check(db)
+	db.Close()
+	if db, err = Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(db)
+}
+
+func TestOpen_CorruptLegacyDataFile(t *testing.T) {
+	dir := t.TempDir()
+	data := encodeLegacy([]byte("legacy_key"), []byte("legacy_value"), Put)
+	data[len(data)-1] ^= 0xff
+	legacy := filepath.Join(dir, LegacyFileName)
+	if err := os.WriteFile(legacy, append(data, encodeLegacy([]byte("legacy_key"), nil, Delete)...), DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(dir); !errors.Is(err, ErrInvalidCrc32) {
+		t.Fatalf("Expected ErrInvalidCrc32, got %v", err)
+	}
+	if _, err := os.Stat(legacy); err != nil {
+		t.Fatalf("Expected the legacy file to be kept, err: %v", err)
+	}
+}
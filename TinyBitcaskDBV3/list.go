@@ -0,0 +1,329 @@
+package TinyBitcaskDBV3
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// listInitialIndex is where the first element of a new list goes, the middle
+// of the index range leaves room to push on either side
+const listInitialIndex uint64 = 1 << 63
+
+var (
+	ErrIndexOutOfRange = errors.New("index out of range")
+)
+
+// listMeta holds the bounds of a list, its elements sit at [head, tail)
+type listMeta struct {
+	head uint64
+	tail uint64
+}
+
+func (m *listMeta) len() int {
+	return int(m.tail - m.head)
+}
+
+// listKeydir indexes the element records of every list. Each element is a
+// record of its own keyed by the list key and its index, the bounds of a list
+// follow from the records, so Open rebuilds them by replaying the log.
+type listKeydir struct {
+	Indexer
+	metas map[string]*listMeta
+}
+
+func newListKeydir(typ IndexType) *listKeydir {
+	return &listKeydir{Indexer: newIndexer(typ), metas: make(map[string]*listMeta)}
+}
+
+func (l *listKeydir) Put(rk []byte, pos *Pos) (*Pos, bool) {
+	if key, idx, ok := decodeListKey(rk); ok {
+		m, ok := l.metas[string(key)]
+		switch {
+		case !ok:
+			l.metas[string(key)] = &listMeta{head: idx, tail: idx + 1}
+		case idx < m.head:
+			m.head = idx
+		case idx >= m.tail:
+			m.tail = idx + 1
+		}
+	}
+	return l.Indexer.Put(rk, pos)
+}
+
+func (l *listKeydir) Delete(rk []byte) (*Pos, bool) {
+	pos, ok := l.Indexer.Delete(rk)
+	if !ok {
+		return nil, false
+	}
+
+	key, _, ok := decodeListKey(rk)
+	m := l.metas[string(key)]
+	if !ok || m == nil {
+		return pos, true
+	}
+	for m.head < m.tail && !l.has(key, m.head) {
+		m.head++
+	}
+	for m.tail > m.head && !l.has(key, m.tail-1) {
+		m.tail--
+	}
+	if m.head == m.tail {
+		delete(l.metas, string(key))
+	}
+	return pos, true
+}
+
+func (l *listKeydir) has(key []byte, idx uint64) bool {
+	_, ok := l.Indexer.Get(listKey(key, idx))
+	return ok
+}
+
+// meta returns the bounds of the list at key, nil if it is empty
+func (l *listKeydir) meta(key []byte) *listMeta {
+	return l.metas[string(key)]
+}
+
+// listKey is the record key of the element at idx of the list at key
+func listKey(key []byte, idx uint64) []byte {
+	sub := make([]byte, 8)
+	binary.BigEndian.PutUint64(sub, idx)
+	return encodeSubKey(key, sub)
+}
+
+func decodeListKey(rk []byte) (key []byte, idx uint64, ok bool) {
+	key, sub := decodeSubKey(rk)
+	if key == nil || len(sub) != 8 {
+		return nil, 0, false
+	}
+	return key, binary.BigEndian.Uint64(sub), true
+}
+
+// listRange resolves start and stop of a list of length n, negative values
+// count from the tail. ok is false if the range is empty.
+func listRange(start, stop, n int) (int, int, bool) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	return start, stop, start <= stop
+}
+
+// LPush inserts values at the head of the list at key, one after another, and
+// returns the new length of the list
+func (db *TinyDB) LPush(key []byte, values ...[]byte) (int, error) {
+	return db.push(key, values, true)
+}
+
+// RPush appends values to the tail of the list at key and returns the new
+// length of the list
+func (db *TinyDB) RPush(key []byte, values ...[]byte) (int, error) {
+	return db.push(key, values, false)
+}
+
+func (db *TinyDB) push(key []byte, values [][]byte, left bool) (n int, err error) {
+	if err = db.checkWrite(key, nil); err != nil {
+		return
+	}
+	for _, value := range values {
+		if err = db.checkWrite(key, value); err != nil {
+			return
+		}
+	}
+
+	err = db.write(false, func() error {
+		head, tail := listInitialIndex, listInitialIndex
+		if m := db.lists.meta(key); m != nil {
+			head, tail = m.head, m.tail
+		}
+
+		entries := make([]*Entry, 0, len(values))
+		for _, value := range values {
+			idx := tail
+			if left {
+				head--
+				idx = head
+			} else {
+				tail++
+			}
+			entries = append(entries, NewEntry(listKey(key, idx), value, Put, List))
+		}
+		if err := db.writeRecords(entries); err != nil {
+			return err
+		}
+		n = int(tail - head)
+		return nil
+	})
+	return
+}
+
+// LPop removes and returns the first element of the list at key
+func (db *TinyDB) LPop(key []byte) ([]byte, error) {
+	return db.pop(key, true)
+}
+
+// RPop removes and returns the last element of the list at key
+func (db *TinyDB) RPop(key []byte) ([]byte, error) {
+	return db.pop(key, false)
+}
+
+func (db *TinyDB) pop(key []byte, left bool) (value []byte, err error) {
+	if err = db.checkWrite(key, nil); err != nil {
+		return
+	}
+
+	err = db.write(false, func() error {
+		if err := db.checkType(key, List); err != nil {
+			return err
+		}
+		m := db.lists.meta(key)
+		if m == nil {
+			return ErrKeyNotFound
+		}
+
+		idx := m.tail - 1
+		if left {
+			idx = m.head
+		}
+		rk := listKey(key, idx)
+		var err error
+		if value, err = db.readRecord(List, rk); err != nil {
+			return err
+		}
+		return db.writeRecord(NewEntry(rk, nil, Delete, List))
+	})
+	return
+}
+
+// LRange returns the elements of the list at key from start to stop, both
+// inclusive, negative indexes count from the tail
+func (db *TinyDB) LRange(key []byte, start, stop int) ([][]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+	if err := db.checkType(key, List); err != nil {
+		return nil, err
+	}
+
+	m := db.lists.meta(key)
+	if m == nil {
+		return nil, nil
+	}
+	start, stop, ok := listRange(start, stop, m.len())
+	if !ok {
+		return nil, nil
+	}
+
+	values := make([][]byte, 0, stop-start+1)
+	for i := start; i <= stop; i++ {
+		value, err := db.readRecord(List, listKey(key, m.head+uint64(i)))
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// LIndex returns the element at index of the list at key, a negative index
+// counts from the tail
+func (db *TinyDB) LIndex(key []byte, index int) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+	if err := db.checkType(key, List); err != nil {
+		return nil, err
+	}
+
+	m := db.lists.meta(key)
+	if m == nil {
+		return nil, ErrKeyNotFound
+	}
+	if index < 0 {
+		index += m.len()
+	}
+	if index < 0 || index >= m.len() {
+		return nil, ErrIndexOutOfRange
+	}
+	return db.readRecord(List, listKey(key, m.head+uint64(index)))
+}
+
+// LLen returns the length of the list at key, 0 if there is none
+func (db *TinyDB) LLen(key []byte) (int, error) {
+	if len(key) == 0 {
+		return 0, ErrEmptyKey
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return 0, ErrDBClosed
+	}
+	if err := db.checkType(key, List); err != nil {
+		return 0, err
+	}
+
+	if m := db.lists.meta(key); m != nil {
+		return m.len(), nil
+	}
+	return 0, nil
+}
+
+// LTrim keeps the elements of the list at key from start to stop, both
+// inclusive, and removes the rest with a single batch
+func (db *TinyDB) LTrim(key []byte, start, stop int) error {
+	if err := db.checkWrite(key, nil); err != nil {
+		return err
+	}
+
+	return db.write(false, func() error {
+		if err := db.checkType(key, List); err != nil {
+			return err
+		}
+		m := db.lists.meta(key)
+		if m == nil {
+			return nil
+		}
+
+		n := m.len()
+		start, stop, ok := listRange(start, stop, n)
+		if !ok {
+			start, stop = n, n-1
+		}
+
+		// deletes go outside in, so that every one of them is at a bound
+		var entries []*Entry
+		for i := 0; i < start; i++ {
+			entries = append(entries, NewEntry(listKey(key, m.head+uint64(i)), nil, Delete, List))
+		}
+		for i := n - 1; i > stop; i-- {
+			entries = append(entries, NewEntry(listKey(key, m.head+uint64(i)), nil, Delete, List))
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return db.writeRecords(entries)
+	})
+}
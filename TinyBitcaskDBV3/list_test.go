@@ -0,0 +1,216 @@
+package TinyBitcaskDBV3
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func listValues(values ...string) [][]byte {
+	out := make([][]byte, 0, len(values))
+	for _, v := range values {
+		out = append(out, []byte(v))
+	}
+	return out
+}
+
+func checkLRange(t *testing.T, db *TinyDB, key string, start, stop int, expected ...string) {
+	t.Helper()
+	values, err := db.LRange([]byte(key), start, stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != len(expected) || (len(values) > 0 && !reflect.DeepEqual(values, listValues(expected...))) {
+		t.Fatalf("Expected LRange(%d, %d) to be %q, got %q", start, stop, expected, values)
+	}
+}
+
+func TestList_PushPop(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	key := []byte("list_key")
+	if n, err := db.RPush(key, listValues("a", "b", "c")...); err != nil || n != 3 {
+		t.Fatalf("Expected length 3, got %d, err: %v", n, err)
+	}
+	if n, err := db.LPush(key, listValues("x", "y")...); err != nil || n != 5 {
+		t.Fatalf("Expected length 5, got %d, err: %v", n, err)
+	}
+	checkLRange(t, db, "list_key", 0, -1, "y", "x", "a", "b", "c")
+
+	if v, err := db.LIndex(key, 0); err != nil || string(v) != "y" {
+		t.Fatalf("Expected y, got %s, err: %v", v, err)
+	}
+	if v, err := db.LIndex(key, -1); err != nil || string(v) != "c" {
+		t.Fatalf("Expected c, got %s, err: %v", v, err)
+	}
+	if _, err := db.LIndex(key, 5); err != ErrIndexOutOfRange {
+		t.Fatalf("Expected ErrIndexOutOfRange, got %v", err)
+	}
+
+	if v, err := db.LPop(key); err != nil || string(v) != "y" {
+		t.Fatalf("Expected y, got %s, err: %v", v, err)
+	}
+	if v, err := db.RPop(key); err != nil || string(v) != "c" {
+		t.Fatalf("Expected c, got %s, err: %v", v, err)
+	}
+	if n, err := db.LLen(key); err != nil || n != 3 {
+		t.Fatalf("Expected length 3, got %d, err: %v", n, err)
+	}
+	checkLRange(t, db, "list_key", 0, -1, "x", "a", "b")
+	checkLRange(t, db, "list_key", -2, 10, "a", "b")
+	checkLRange(t, db, "list_key", 3, 10)
+
+	for i := 0; i < 3; i++ {
+		if _, err := db.RPop(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.LPop(key); err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+	if n, err := db.LLen(key); err != nil || n != 0 {
+		t.Fatalf("Expected an empty list, got %d, err: %v", n, err)
+	}
+
+	// lists do not touch the string keys
+	if _, err := db.Get(key); err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestList_Trim(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	key := []byte("trim_key")
+	for i := 0; i < 10; i++ {
+		db.RPush(key, []byte(fmt.Sprint(i)))
+	}
+
+	if err := db.LTrim(key, 2, -3); err != nil {
+		t.Fatal(err)
+	}
+	checkLRange(t, db, "trim_key", 0, -1, "2", "3", "4", "5", "6", "7")
+
+	if err := db.LTrim(key, 5, 1); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.LLen(key); err != nil || n != 0 {
+		t.Fatalf("Expected an empty list, got %d, err: %v", n, err)
+	}
+}
+
+func TestList_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, WithMaxFileSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Put([]byte("list_key"), []byte("string_value")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if _, err := db.RPush([]byte("list_key"), []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.LPush([]byte("list_key"), []byte(fmt.Sprint(-i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.LTrim([]byte("list_key"), 15, -16)
+	db.LPop([]byte("list_key"))
+	db.RPop([]byte("list_key"))
+	db.RPush([]byte("other_list"), listValues("a", "b")...)
+
+	check := func(db *TinyDB) {
+		t.Helper()
+		checkLRange(t, db, "list_key", 0, -1, "-3", "-2", "-1", "0", "0", "1", "2", "3")
+		checkLRange(t, db, "other_list", 0, -1, "a", "b")
+		if v, err := db.Get([]byte("list_key")); err != nil || string(v) != "string_value" {
+			t.Fatalf("Expected string_value, got %s, err: %v", v, err)
+		}
+	}
+
+	check(db)
+	db.Close()
+	if db, err = Open(dir, WithMaxFileSize(256)); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+	db.Close()
+	if db, err = Open(dir, WithMaxFileSize(256)); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(db)
+
+	if n, err := db.LPush([]byte("list_key"), []byte("-4")); err != nil || n != 9 {
+		t.Fatalf("Expected length 9, got %d, err: %v", n, err)
+	}
+	checkLRange(t, db, "list_key", 0, 1, "-4", "-3")
+}
+
+func TestList_StringsNextToLists(t *testing.T) {
+	dir := t.TempDir()
+	// Put, Del, batches and transactions write String records next to the
+	// List records
+	db, err := Open(dir, WithMaxFileSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := db.Put([]byte(fmt.Sprint("put_key_", i)), []byte("put_value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Del([]byte("put_key_0"))
+	wb := db.NewWriteBatch()
+	wb.Put([]byte("batch_key"), []byte("batch_value"))
+	if err := wb.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *Tx) error {
+		return tx.Put([]byte("tx_key"), []byte("tx_value"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(db *TinyDB) {
+		t.Helper()
+		for key, value := range map[string]string{"put_key_9": "put_value", "batch_key": "batch_value", "tx_key": "tx_value"} {
+			if v, err := db.Get([]byte(key)); err != nil || string(v) != value {
+				t.Fatalf("Expected %s=%s, got %s, err: %v", key, value, v, err)
+			}
+		}
+		if _, err := db.Get([]byte("put_key_0")); err != ErrKeyNotFound {
+			t.Fatalf("Expected put_key_0 to be deleted, got %v", err)
+		}
+	}
+
+	db.Close()
+	if db, err = Open(dir, WithMaxFileSize(256)); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(db)
+
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+}
@@ -0,0 +1,48 @@
+package TinyBitcaskDBV3
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const (
+	LockFileName = "TinyDB.lock"
+)
+
+var (
+	ErrDatabaseLocked = errors.New("database is locked by another process")
+)
+
+// dirLock keeps other processes and other Open calls away from a database
+// directory, writers hold it exclusively and read-only opens share it
+type dirLock struct {
+	file *os.File
+}
+
+func lockDir(dirPath string, shared bool, perm os.FileMode) (*dirLock, error) {
+	flag := os.O_CREATE | os.O_RDWR
+	if shared {
+		flag = os.O_CREATE | os.O_RDONLY
+	}
+
+	file, err := os.OpenFile(filepath.Join(dirPath, LockFileName), flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := flock(file, shared); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &dirLock{file: file}, nil
+}
+
+func (l *dirLock) release() error {
+	if err := funlock(l.file); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package TinyBitcaskDBV3
+
+import "os"
+
+// flock is not available here, the lock file only marks the directory
+func flock(file *os.File, shared bool) error {
+	return nil
+}
+
+func funlock(file *os.File) error {
+	return nil
+}
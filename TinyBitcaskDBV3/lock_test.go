@@ -0,0 +1,42 @@
+package TinyBitcaskDBV3
+
+import (
+	"testing"
+)
+
+func TestOpen_Locked(t *testing.T) {
+	dirPath := t.TempDir()
+	db, err := Open(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(dirPath); err != ErrDatabaseLocked {
+		t.Fatalf("Expected ErrDatabaseLocked, got %v", err)
+	}
+	if _, err := Open(dirPath, WithReadOnly(true)); err != ErrDatabaseLocked {
+		t.Fatalf("Expected ErrDatabaseLocked for read-only open, got %v", err)
+	}
+
+	if err := db.Put([]byte("lock_key"), []byte("lock_value")); err != nil {
+		t.Fatal("Put err: ", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal("Close err: ", err)
+	}
+
+	rdb1, err := Open(dirPath, WithReadOnly(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdb1.Close()
+	rdb2, err := Open(dirPath, WithReadOnly(true))
+	if err != nil {
+		t.Fatal("Expected read-only opens to share the lock, got ", err)
+	}
+	defer rdb2.Close()
+
+	if _, err := Open(dirPath); err != ErrDatabaseLocked {
+		t.Fatalf("Expected ErrDatabaseLocked while read-only opens are active, got %v", err)
+	}
+}
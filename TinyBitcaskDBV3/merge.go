@@ -0,0 +1,367 @@
+package TinyBitcaskDBV3
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	MergeFinFileName = "merge.fin"
+)
+
+var (
+	ErrMergeInProgress = errors.New("merge is in progress")
+	ErrInvalidMergeFin = errors.New("invalid merge finished file")
+)
+
+// mergeRecord remembers where a rewritten entry came from, so the index is
+// only switched over if no newer write replaced the key during the merge. A
+// nil newPos means the entry expired and was dropped.
+type mergeRecord struct {
+	typ    uint16
+	key    []byte
+	oldPos *Pos
+	newPos *Pos
+}
+
+// mergeFin is written into the merge directory once every merged file is on
+// disk, its presence means the merge can be completed after a crash
+type mergeFin struct {
+	nonMergeFileID uint32   // files below this id are replaced by the merge
+	fileIDs        []uint32 // ids of the merged files
+}
+
+// Merge rewrites the live entries of all immutable data files into new files
+// and drops the rest. Only the freeze of the active file and the final swap
+// hold db.mu, so reads and writes go on while the files are compacted.
+func (db *TinyDB) Merge() error {
+	if db.opts.ReadOnly {
+		return ErrReadOnly
+	}
+
+	fids, files, nonMergeFileID, maxFileSize, err := db.prepareMerge()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		db.mu.Lock()
+		db.merging = false
+		db.mu.Unlock()
+	}()
+
+	mergePath := filepath.Join(db.dirPath, MergeDirName)
+	if err := os.RemoveAll(mergePath); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(mergePath, os.ModePerm); err != nil {
+		return err
+	}
+
+	records, fin, err := db.compact(mergePath, fids, files, nonMergeFileID, maxFileSize)
+	if err != nil {
+		os.RemoveAll(mergePath)
+		return err
+	}
+
+	if err := writeMergeFin(mergePath, fin, db.opts.FilePerm); err != nil {
+		os.RemoveAll(mergePath)
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		os.RemoveAll(mergePath)
+		return ErrDBClosed
+	}
+
+	for _, fid := range fids {
+		if db.pinned() {
+			db.retired = append(db.retired, db.olderFiles[fid])
+		} else {
+			db.olderFiles[fid].Close()
+		}
+		delete(db.olderFiles, fid)
+		delete(db.deadBytes, fid)
+	}
+
+	if err := db.applyMerge(); err != nil {
+		return err
+	}
+
+	for _, fid := range fin.fileIDs {
+		dbFile, err := db.openDBFile(db.dirPath, fid)
+		if err != nil {
+			return err
+		}
+		db.olderFiles[fid] = dbFile
+	}
+
+	for _, r := range records {
+		kd := db.keydir(r.typ)
+		pos, ok := kd.Get(r.key)
+		if !ok || pos.FileID != r.oldPos.FileID || pos.Offset != r.oldPos.Offset {
+			continue
+		}
+		if r.newPos == nil {
+			db.indexDelete(r.key)
+		} else {
+			kd.Put(r.key, r.newPos)
+		}
+	}
+	db.resetDeadBytes(fin.fileIDs...)
+
+	return nil
+}
+
+// prepareMerge freezes the active file and returns the files to be merged
+func (db *TinyDB) prepareMerge() (fids []uint32, files map[uint32]*DBFile, nonMergeFileID uint32, maxFileSize int64, err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		err = ErrDBClosed
+		return
+	}
+
+	if db.merging {
+		err = ErrMergeInProgress
+		return
+	}
+
+	if len(db.olderFiles) == 0 && db.activeFile.Offset == 0 {
+		err = ErrInvalidOffset
+		return
+	}
+
+	if db.activeFile.Offset > 0 {
+		if err = db.rotate(); err != nil {
+			return
+		}
+	}
+
+	files = make(map[uint32]*DBFile, len(db.olderFiles))
+	for fid, dbFile := range db.olderFiles {
+		fids = append(fids, fid)
+		files[fid] = dbFile
+	}
+	sortFileIDs(fids)
+
+	db.merging = true
+	return fids, files, db.activeFile.FileID, db.opts.MaxFileSize, nil
+}
+
+// compact copies the live entries of files into mergePath, merged files reuse
+// the ids of the files they replace and never reach nonMergeFileID
+func (db *TinyDB) compact(mergePath string, fids []uint32, files map[uint32]*DBFile, nonMergeFileID uint32, maxFileSize int64) ([]*mergeRecord, *mergeFin, error) {
+	fin := &mergeFin{nonMergeFileID: nonMergeFileID, fileIDs: []uint32{fids[0]}}
+	mergeFile, hintFile, err := db.newMergeFiles(mergePath, fids[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		mergeFile.Close()
+		hintFile.Close()
+	}()
+
+	var records []*mergeRecord
+	limiter := newRateLimiter(db.mergeRateLimit())
+	now := time.Now().UnixNano()
+	for _, fid := range fids {
+		er := files[fid].newEntryReader()
+
+		var offset int64
+		for {
+			e, err := er.Next()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, nil, err
+			}
+
+			// tombstones are never in the index, so they are dropped here. That
+			// is safe because a merge always covers every file older than
+			// nonMergeFileID, no older entry is left for them to shadow.
+			db.mu.RLock()
+			pos, ok := db.keydir(e.Type).Get(e.Meta.Key)
+			db.mu.RUnlock()
+
+			live := ok && pos.FileID == fid && pos.Offset == offset
+			switch {
+			case live && e.expired(now):
+				// expired entries are dropped too, the swap removes them from the index
+				records = append(records, &mergeRecord{typ: e.Type, key: e.Meta.Key, oldPos: pos})
+			case live:
+				if mergeFile.Offset > 0 && mergeFile.Offset+e.Size() > maxFileSize && mergeFile.FileID+1 < nonMergeFileID {
+					if err := closeMergeFiles(mergeFile, hintFile); err != nil {
+						return nil, nil, err
+					}
+					if mergeFile, hintFile, err = db.newMergeFiles(mergePath, mergeFile.FileID+1); err != nil {
+						return nil, nil, err
+					}
+					fin.fileIDs = append(fin.fileIDs, mergeFile.FileID)
+				}
+
+				// the entry is committed, so it no longer needs its batch marker
+				e.BatchID = 0
+				newPos := &Pos{FileID: mergeFile.FileID, Offset: mergeFile.Offset, Size: e.Size(), ExpiresAt: e.ExpiresAt, Seq: e.Seq}
+				if err := mergeFile.Write(e); err != nil {
+					return nil, nil, err
+				}
+				if err := hintFile.Write(NewHint(e.Meta.Key, e.Mark, e.Type, newPos)); err != nil {
+					return nil, nil, err
+				}
+				records = append(records, &mergeRecord{typ: e.Type, key: e.Meta.Key, oldPos: pos, newPos: newPos})
+				db.logf("validEntries key: %s, value: %s, offset: %d\n", string(e.Meta.Key), string(e.Meta.Value), offset)
+			}
+
+			limiter.wait(e.Size())
+			offset += e.Size()
+			db.logf("Read offset: %d\n", offset)
+		}
+	}
+
+	if err := closeMergeFiles(mergeFile, hintFile); err != nil {
+		return nil, nil, err
+	}
+	return records, fin, nil
+}
+
+func (db *TinyDB) newMergeFiles(mergePath string, fid uint32) (*DBFile, *HintFile, error) {
+	mergeFile, err := db.openDBFile(mergePath, fid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hintFile, err := OpenHintFile(mergePath, fid, os.O_CREATE|os.O_RDWR|os.O_APPEND, db.opts.FilePerm)
+	if err != nil {
+		mergeFile.Close()
+		return nil, nil, err
+	}
+
+	return mergeFile, hintFile, nil
+}
+
+func closeMergeFiles(mergeFile *DBFile, hintFile *HintFile) error {
+	defer mergeFile.Close()
+	defer hintFile.Close()
+
+	if err := mergeFile.Sync(); err != nil {
+		return err
+	}
+	return hintFile.Sync()
+}
+
+// applyMerge moves a finished merge from the merge directory into the data
+// directory. It is idempotent, so a crash half way through is completed on the
+// next Open. A merge directory without the finished file is an aborted merge
+// and removed.
+func (db *TinyDB) applyMerge() error {
+	mergePath := filepath.Join(db.dirPath, MergeDirName)
+	if _, err := os.Stat(mergePath); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	fin, err := readMergeFin(mergePath)
+	if err != nil {
+		db.logf("discard unfinished merge: %v\n", err)
+		return os.RemoveAll(mergePath)
+	}
+
+	merged := make(map[uint32]bool, len(fin.fileIDs))
+	for _, fid := range fin.fileIDs {
+		merged[fid] = true
+	}
+
+	fids, err := ListDataFileIDs(db.dirPath)
+	if err != nil {
+		return err
+	}
+	for _, fid := range fids {
+		if fid >= fin.nonMergeFileID || merged[fid] {
+			continue
+		}
+		if err := os.Remove(DataFileName(db.dirPath, fid)); err != nil {
+			return err
+		}
+		if err := os.Remove(HintFileName(db.dirPath, fid)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	for _, fid := range fin.fileIDs {
+		if err := renameIfExist(HintFileName(mergePath, fid), HintFileName(db.dirPath, fid)); err != nil {
+			return err
+		}
+		if err := renameIfExist(DataFileName(mergePath, fid), DataFileName(db.dirPath, fid)); err != nil {
+			return err
+		}
+	}
+
+	return os.RemoveAll(mergePath)
+}
+
+func renameIfExist(oldPath, newPath string) error {
+	if err := os.Rename(oldPath, newPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func mergeFinFileName(mergePath string) string {
+	return filepath.Join(mergePath, MergeFinFileName)
+}
+
+// writeMergeFin persists fin as crc | nonMergeFileID | count | fileIDs...
+func writeMergeFin(mergePath string, fin *mergeFin, perm os.FileMode) error {
+	buf := make([]byte, 12+4*len(fin.fileIDs))
+	binary.BigEndian.PutUint32(buf[4:8], fin.nonMergeFileID)
+	binary.BigEndian.PutUint32(buf[8:12], uint32(len(fin.fileIDs)))
+	for i, fid := range fin.fileIDs {
+		binary.BigEndian.PutUint32(buf[12+4*i:], fid)
+	}
+	binary.BigEndian.PutUint32(buf[0:4], crc32.ChecksumIEEE(buf[4:]))
+
+	file, err := os.OpenFile(mergeFinFileName(mergePath), os.O_CREATE|os.O_RDWR|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(buf); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+func readMergeFin(mergePath string) (*mergeFin, error) {
+	buf, err := os.ReadFile(mergeFinFileName(mergePath))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) < 12 || binary.BigEndian.Uint32(buf[0:4]) != crc32.ChecksumIEEE(buf[4:]) {
+		return nil, ErrInvalidMergeFin
+	}
+
+	count := int(binary.BigEndian.Uint32(buf[8:12]))
+	if len(buf) != 12+4*count {
+		return nil, ErrInvalidMergeFin
+	}
+
+	fin := &mergeFin{nonMergeFileID: binary.BigEndian.Uint32(buf[4:8])}
+	for i := 0; i < count; i++ {
+		fin.fileIDs = append(fin.fileIDs, binary.BigEndian.Uint32(buf[12+4*i:]))
+	}
+	return fin, nil
+}
@@ -0,0 +1,161 @@
+package TinyBitcaskDBV3
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTinyDB_MergeOnline(t *testing.T) {
+	dirPath := t.TempDir()
+	db, err := Open(dirPath, WithMaxFileSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { db.Close() }()
+
+	for i := 0; i < TestNum; i++ {
+		key := []byte("merge_key_" + strconv.Itoa(i%TestMod))
+		if err := db.Put(key, []byte("merge_value_"+strconv.Itoa(i))); err != nil {
+			t.Fatal("Put err: ", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < TestNum; i++ {
+			key := []byte("online_key_" + strconv.Itoa(i))
+			if err := db.Put(key, []byte("online_value_"+strconv.Itoa(i))); err != nil {
+				t.Error("Put err: ", err)
+			}
+			if _, err := db.Get([]byte("merge_key_0")); err != nil {
+				t.Error("Get err: ", err)
+			}
+		}
+	}()
+
+	if err := db.Merge(); err != nil {
+		t.Fatal("merge err: ", err)
+	}
+	wg.Wait()
+
+	if err := db.Put([]byte("merge_key_0"), []byte("after_merge")); err != nil {
+		t.Fatal("Put err: ", err)
+	}
+
+	check := func(db *TinyDB) {
+		if v, err := db.Get([]byte("merge_key_0")); err != nil || string(v) != "after_merge" {
+			t.Fatalf("Expected merge_key_0=after_merge, got %s instead, err: %v", string(v), err)
+		}
+		for i := TestNum - TestMod + 1; i < TestNum; i++ {
+			key := []byte("merge_key_" + strconv.Itoa(i%TestMod))
+			if v, err := db.Get(key); err != nil || string(v) != "merge_value_"+strconv.Itoa(i) {
+				t.Fatalf("Expected %s=merge_value_%d, got %s instead, err: %v", key, i, string(v), err)
+			}
+		}
+		for i := 0; i < TestNum; i++ {
+			key := []byte("online_key_" + strconv.Itoa(i))
+			if v, err := db.Get(key); err != nil || string(v) != "online_value_"+strconv.Itoa(i) {
+				t.Fatalf("Expected %s=online_value_%d, got %s instead, err: %v", key, i, string(v), err)
+			}
+		}
+	}
+
+	check(db)
+	db.Close()
+	db, err = Open(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+}
+
+func TestTinyDB_MergeRecovery(t *testing.T) {
+	dirPath := t.TempDir()
+	db, err := Open(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { db.Close() }()
+
+	for i := 0; i < TestNum; i++ {
+		key := []byte("merge_key_" + strconv.Itoa(i%TestMod))
+		if err := db.Put(key, []byte("merge_value_"+strconv.Itoa(i))); err != nil {
+			t.Fatal("Put err: ", err)
+		}
+	}
+
+	// crash after the merged files are written but before the swap
+	fids, files, nonMergeFileID, maxFileSize, err := db.prepareMerge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mergePath := filepath.Join(dirPath, MergeDirName)
+	if err := os.MkdirAll(mergePath, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	_, fin, err := db.compact(mergePath, fids, files, nonMergeFileID, maxFileSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeMergeFin(mergePath, fin, DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(DataFileName(dirPath, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.Close()
+	db, err = Open(dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(mergePath); !os.IsNotExist(err) {
+		t.Fatal("Expected merge dir to be cleaned, err: ", err)
+	}
+	after, err := os.Stat(DataFileName(dirPath, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Size() >= before.Size() {
+		t.Fatalf("Expected merged file to be smaller, before: %d, after: %d", before.Size(), after.Size())
+	}
+
+	for i := TestNum - TestMod; i < TestNum; i++ {
+		key := []byte("merge_key_" + strconv.Itoa(i%TestMod))
+		if v, err := db.Get(key); err != nil || string(v) != "merge_value_"+strconv.Itoa(i) {
+			t.Fatalf("Expected %s=merge_value_%d, got %s instead, err: %v", key, i, string(v), err)
+		}
+	}
+
+	// an unfinished merge is thrown away
+	if err := os.MkdirAll(mergePath, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(DataFileName(mergePath, 0), []byte("partial"), DefaultFilePerm); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	var logs bytes.Buffer
+	db, err = Open(dirPath, WithDebug(true), WithLogger(log.New(&logs, "", 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(mergePath); !os.IsNotExist(err) {
+		t.Fatal("Expected merge dir to be removed, err: ", err)
+	}
+	if !strings.Contains(logs.String(), "discard unfinished merge") {
+		t.Fatalf("Expected the discarded merge to be logged through Options.Logger, got %q", logs.String())
+	}
+	if v, err := db.Get([]byte("merge_key_0")); err != nil || string(v) != "merge_value_95" {
+		t.Fatalf("Expected merge_key_0=merge_value_95, got %s instead, err: %v", string(v), err)
+	}
+}
@@ -0,0 +1,149 @@
+package TinyBitcaskDBV3
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrConflict = errors.New("transaction conflict")
+)
+
+// version is an entry that was overwritten or deleted at seq end while a
+// transaction was open. It stays readable through file, which a merge does
+// not close until no transaction needs it any more.
+type version struct {
+	pos  *Pos
+	file *DBFile
+	end  uint64
+}
+
+// acquireSnapshot registers a transaction reading as of the current seq, the
+// caller must hold db.mu
+func (db *TinyDB) acquireSnapshot() uint64 {
+	db.snapshots[db.seq]++
+	return db.seq
+}
+
+// releaseSnapshot unregisters a transaction started at seq and forgets the
+// versions nobody can see any more, the caller must hold db.mu
+func (db *TinyDB) releaseSnapshot(seq uint64) error {
+	if db.snapshots[seq]--; db.snapshots[seq] <= 0 {
+		delete(db.snapshots, seq)
+	}
+
+	if len(db.snapshots) == 0 {
+		db.versions = make(map[string][]*version)
+		return db.releaseRetired()
+	}
+
+	oldest := ^uint64(0)
+	for s := range db.snapshots {
+		if s < oldest {
+			oldest = s
+		}
+	}
+	for key, versions := range db.versions {
+		live := versions[:0]
+		for _, v := range versions {
+			if v.end > oldest {
+				live = append(live, v)
+			}
+		}
+		if len(live) == 0 {
+			delete(db.versions, key)
+		} else {
+			db.versions[key] = live
+		}
+	}
+	return nil
+}
+
+// keepVersion remembers old, replaced by the commit seq, for the open
+// transactions, the caller must hold db.mu
+func (db *TinyDB) keepVersion(key []byte, old *Pos, seq uint64) {
+	if len(db.snapshots) == 0 {
+		return
+	}
+	db.versions[string(key)] = append(db.versions[string(key)], &version{pos: old, file: db.getDBFile(old.FileID), end: seq})
+}
+
+// pinned reports whether iterators or transactions still read from data files
+// that a merge replaces
+func (db *TinyDB) pinned() bool {
+	return db.iterators > 0 || len(db.snapshots) > 0
+}
+
+// releaseRetired closes the files retired by a merge once they are no longer
+// pinned, the caller must hold db.mu
+func (db *TinyDB) releaseRetired() error {
+	if db.pinned() || db.closed {
+		return nil
+	}
+
+	var err error
+	for _, dbFile := range db.retired {
+		if cerr := dbFile.Close(); err == nil {
+			err = cerr
+		}
+	}
+	db.retired = nil
+	return err
+}
+
+// getAt returns the value key had as of commit seq
+func (db *TinyDB) getAt(key []byte, seq uint64) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+
+	pos, dbFile := db.versionAt(key, seq)
+	if pos == nil || pos.expired(time.Now().UnixNano()) {
+		return nil, ErrKeyNotFound
+	}
+	if dbFile == nil {
+		return nil, fmt.Errorf("%w: data file %d is missing", ErrInvalidDBFile, pos.FileID)
+	}
+
+	e, err := dbFile.ReadSized(pos.Offset, pos.Size)
+	if err != nil {
+		return nil, err
+	}
+	return e.Meta.Value, nil
+}
+
+// versionAt finds the entry of key that was current at seq, nil if the key did
+// not exist then
+func (db *TinyDB) versionAt(key []byte, seq uint64) (*Pos, *DBFile) {
+	if pos, ok := db.indexes.Get(key); ok && pos.Seq <= seq {
+		return pos, db.getDBFile(pos.FileID)
+	}
+	for _, v := range db.versions[string(key)] {
+		if v.pos.Seq <= seq && seq < v.end {
+			return v.pos, v.file
+		}
+	}
+	return nil, nil
+}
+
+// changedSince reports whether a commit after seq wrote or deleted key, the
+// caller must hold db.mu
+func (db *TinyDB) changedSince(key []byte, seq uint64) bool {
+	if pos, ok := db.indexes.Get(key); ok && pos.Seq > seq {
+		return true
+	}
+	for _, v := range db.versions[string(key)] {
+		if v.end > seq {
+			return true
+		}
+	}
+	return false
+}
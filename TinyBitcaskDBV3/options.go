@@ -0,0 +1,209 @@
+package TinyBitcaskDBV3
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+var (
+	ErrInvalidOptions = errors.New("invalid options")
+)
+
+// Options configures a TinyDB, start from DefaultOptions and adjust it
+type Options struct {
+	MaxFileSize        int64 // rotate the active file once it would grow past this size
+	SyncPolicy         SyncPolicy
+	SyncInterval       time.Duration // flush interval of SyncInterval
+	SyncBytes          int64         // threshold of SyncBytes
+	AutoMerge          AutoMergeConfig
+	ReadOnly           bool        // open the existing data files without writing anything
+	FilePerm           os.FileMode // permission of newly created files
+	MaxKeySize         int
+	MaxValueSize       int
+	TruncateTornWrites bool        // drop a half written entry at the end of the active file on Open
+	Logger             *log.Logger // destination of debug logs, the standard logger if nil
+	Debug              bool
+	IndexType          IndexType     // in-memory index implementation
+	TTLSweepInterval   time.Duration // how often expired keys are dropped from the index, 0 disables
+	TxRetries          int           // how often Update retries a transaction after ErrConflict
+}
+
+// Option changes one field of Options
+type Option func(*Options)
+
+func DefaultOptions() Options {
+	return Options{
+		MaxFileSize:        DefaultMaxFileSize,
+		AutoMerge:          DefaultAutoMergeConfig(),
+		FilePerm:           DefaultFilePerm,
+		MaxKeySize:         maxKeyLen,
+		MaxValueSize:       maxValueLen,
+		TruncateTornWrites: true,
+		TTLSweepInterval:   DefaultTTLSweepInterval,
+	}
+}
+
+// Validate reports the first invalid field
+func (o *Options) Validate() error {
+	switch {
+	case o.MaxFileSize <= 0:
+		return fmt.Errorf("%w: MaxFileSize must be positive, got %d", ErrInvalidOptions, o.MaxFileSize)
+	case o.MaxKeySize <= 0 || o.MaxKeySize > maxKeyLen:
+		return fmt.Errorf("%w: MaxKeySize must be in (0, %d], got %d", ErrInvalidOptions, maxKeyLen, o.MaxKeySize)
+	case o.MaxValueSize < 0 || o.MaxValueSize > maxValueLen:
+		return fmt.Errorf("%w: MaxValueSize must be in [0, %d], got %d", ErrInvalidOptions, maxValueLen, o.MaxValueSize)
+	case o.FilePerm == 0:
+		return fmt.Errorf("%w: FilePerm must not be zero", ErrInvalidOptions)
+	case o.AutoMerge.Interval < 0:
+		return fmt.Errorf("%w: AutoMerge.Interval must not be negative, got %v", ErrInvalidOptions, o.AutoMerge.Interval)
+	case o.AutoMerge.DeadRatio < 0 || o.AutoMerge.DeadRatio > 1:
+		return fmt.Errorf("%w: AutoMerge.DeadRatio must be in [0, 1], got %v", ErrInvalidOptions, o.AutoMerge.DeadRatio)
+	case o.AutoMerge.TotalSize < 0:
+		return fmt.Errorf("%w: AutoMerge.TotalSize must not be negative, got %d", ErrInvalidOptions, o.AutoMerge.TotalSize)
+	case o.AutoMerge.SizeDeadRatio < 0 || o.AutoMerge.SizeDeadRatio > 1:
+		return fmt.Errorf("%w: AutoMerge.SizeDeadRatio must be in [0, 1], got %v", ErrInvalidOptions, o.AutoMerge.SizeDeadRatio)
+	case o.IndexType > ARTIndex:
+		return fmt.Errorf("%w: unknown IndexType %d", ErrInvalidOptions, o.IndexType)
+	case o.SyncPolicy > SyncBytes:
+		return fmt.Errorf("%w: unknown SyncPolicy %d", ErrInvalidOptions, o.SyncPolicy)
+	case o.SyncPolicy == SyncInterval && o.SyncInterval <= 0:
+		return fmt.Errorf("%w: SyncInterval must be positive, got %v", ErrInvalidOptions, o.SyncInterval)
+	case o.SyncPolicy == SyncBytes && o.SyncBytes <= 0:
+		return fmt.Errorf("%w: SyncBytes must be positive, got %d", ErrInvalidOptions, o.SyncBytes)
+	case o.TxRetries < 0:
+		return fmt.Errorf("%w: TxRetries must not be negative, got %d", ErrInvalidOptions, o.TxRetries)
+	case o.TTLSweepInterval < 0:
+		return fmt.Errorf("%w: TTLSweepInterval must not be negative, got %v", ErrInvalidOptions, o.TTLSweepInterval)
+	case o.AutoMerge.RateLimit < 0:
+		return fmt.Errorf("%w: AutoMerge.RateLimit must not be negative, got %d", ErrInvalidOptions, o.AutoMerge.RateLimit)
+	}
+	return nil
+}
+
+// WithOptions replaces all options with opts
+func WithOptions(opts Options) Option {
+	return func(o *Options) {
+		*o = opts
+	}
+}
+
+func WithMaxFileSize(size int64) Option {
+	return func(o *Options) {
+		o.MaxFileSize = size
+	}
+}
+
+// WithSyncWrites switches between SyncAlways and SyncNever
+func WithSyncWrites(sync bool) Option {
+	return func(o *Options) {
+		if sync {
+			o.SyncPolicy = SyncAlways
+		} else {
+			o.SyncPolicy = SyncNever
+		}
+	}
+}
+
+func WithSyncPolicy(policy SyncPolicy) Option {
+	return func(o *Options) {
+		o.SyncPolicy = policy
+	}
+}
+
+// WithSyncInterval fsyncs in the background every interval
+func WithSyncInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.SyncPolicy = SyncInterval
+		o.SyncInterval = interval
+	}
+}
+
+// WithSyncBytes fsyncs once size bytes were written since the last fsync
+func WithSyncBytes(size int64) Option {
+	return func(o *Options) {
+		o.SyncPolicy = SyncBytes
+		o.SyncBytes = size
+	}
+}
+
+func WithAutoMerge(cfg AutoMergeConfig) Option {
+	return func(o *Options) {
+		o.AutoMerge = cfg
+	}
+}
+
+func WithReadOnly(readOnly bool) Option {
+	return func(o *Options) {
+		o.ReadOnly = readOnly
+	}
+}
+
+func WithFilePerm(perm os.FileMode) Option {
+	return func(o *Options) {
+		o.FilePerm = perm
+	}
+}
+
+func WithMaxKeySize(size int) Option {
+	return func(o *Options) {
+		o.MaxKeySize = size
+	}
+}
+
+func WithMaxValueSize(size int) Option {
+	return func(o *Options) {
+		o.MaxValueSize = size
+	}
+}
+
+func WithTruncateTornWrites(truncate bool) Option {
+	return func(o *Options) {
+		o.TruncateTornWrites = truncate
+	}
+}
+
+func WithLogger(logger *log.Logger) Option {
+	return func(o *Options) {
+		o.Logger = logger
+	}
+}
+
+func WithDebug(debug bool) Option {
+	return func(o *Options) {
+		o.Debug = debug
+	}
+}
+
+func WithIndexType(typ IndexType) Option {
+	return func(o *Options) {
+		o.IndexType = typ
+	}
+}
+
+func WithTTLSweepInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.TTLSweepInterval = interval
+	}
+}
+
+func WithTxRetries(retries int) Option {
+	return func(o *Options) {
+		o.TxRetries = retries
+	}
+}
+
+// logf writes a debug log if either DBug or Options.Debug is on
+func (db *TinyDB) logf(format string, args ...interface{}) {
+	if DBug == 0 && !db.opts.Debug {
+		return
+	}
+
+	if db.opts.Logger != nil {
+		db.opts.Logger.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
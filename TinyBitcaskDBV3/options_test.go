@@ -0,0 +1,89 @@
+package TinyBitcaskDBV3
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOptions_Validate(t *testing.T) {
+	opts := DefaultOptions()
+	if err := opts.Validate(); err != nil {
+		t.Fatal("default options invalid: ", err)
+	}
+
+	invalid := []Option{
+		WithMaxFileSize(0),
+		WithMaxKeySize(0),
+		WithMaxValueSize(-1),
+		WithFilePerm(0),
+		WithAutoMerge(AutoMergeConfig{DeadRatio: 2}),
+		WithAutoMerge(AutoMergeConfig{SizeDeadRatio: -0.1}),
+		WithAutoMerge(AutoMergeConfig{RateLimit: -1}),
+		WithIndexType(ARTIndex + 1),
+		WithTTLSweepInterval(-time.Second),
+		WithTxRetries(-1),
+		WithSyncInterval(0),
+		WithSyncBytes(0),
+		WithSyncPolicy(SyncBytes + 1),
+	}
+	for i, opt := range invalid {
+		if _, err := Open(t.TempDir(), opt); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("option %d: expected ErrInvalidOptions, got %v", i, err)
+		}
+	}
+}
+
+func TestOptions_SizeLimits(t *testing.T) {
+	db, err := Open(t.TempDir(), WithMaxKeySize(8), WithMaxValueSize(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Put([]byte(strings.Repeat("k", 9)), []byte("v")); err != ErrKeyTooLong {
+		t.Errorf("Expected ErrKeyTooLong, got %v", err)
+	}
+	if err := db.Put([]byte("k"), []byte(strings.Repeat("v", 9))); err != ErrValueTooLong {
+		t.Errorf("Expected ErrValueTooLong, got %v", err)
+	}
+	if err := db.Put([]byte("k"), []byte("v")); err != nil {
+		t.Errorf("Put err: %v", err)
+	}
+}
+
+func TestOptions_ReadOnly(t *testing.T) {
+	dirPath := t.TempDir()
+	if _, err := Open(dirPath, WithReadOnly(true)); err == nil {
+		t.Fatal("Expected read-only open of an empty directory to fail")
+	}
+
+	db, err := Open(dirPath, WithSyncWrites(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatal("Put err: ", err)
+	}
+	db.Close()
+
+	rdb, err := Open(dirPath, WithReadOnly(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdb.Close()
+	if v, err := rdb.Get([]byte("key")); err != nil || string(v) != "value" {
+		t.Fatalf("Expected key=value, got %s instead, err: %v", string(v), err)
+	}
+	if err := rdb.Put([]byte("key"), []byte("other")); err != ErrReadOnly {
+		t.Errorf("Expected ErrReadOnly from Put, got %v", err)
+	}
+	if err := rdb.Del([]byte("key")); err != ErrReadOnly {
+		t.Errorf("Expected ErrReadOnly from Del, got %v", err)
+	}
+	if err := rdb.Merge(); err != ErrReadOnly {
+		t.Errorf("Expected ErrReadOnly from Merge, got %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package TinyBitcaskDBV3
+
+import (
+	"sync"
+)
+
+const (
+	maxWriteGroup  = 128     // requests a leader commits at once
+	maxWriteBuffer = 4 << 20 // a larger write buffer is not kept for reuse
+)
+
+// writeRequest is a Put, Del, batch or transaction commit queued in the write
+// pipeline. fn runs under db.mu and appends through writeEntry or writeBatch.
+type writeRequest struct {
+	sync bool
+	fn   func() error
+
+	pos   []*Pos // entries fn appended
+	err   error
+	done  bool
+	ready chan struct{} // closed once done or promoted to leader
+}
+
+// writePipeline queues concurrent writes. The writer that finds no leader
+// leads: it takes the queue as one write group, runs the whole group under a
+// single db.mu, appends its entries with one write and fsyncs once, then wakes
+// every caller with its own result. Leadership passes on before the fsync, so
+// the next group fills up while the disk is busy.
+type writePipeline struct {
+	mu      sync.Mutex
+	queue   []*writeRequest
+	leading bool
+}
+
+// writeBuffer holds the encoded entries of the running write group until they
+// are flushed to the active file
+type writeBuffer struct {
+	buf     []byte
+	req     *writeRequest   // request running, nil outside of a write group
+	pending []*writeRequest // requests with entries in buf
+	undo    []indexUndo     // index changes of the entries in buf
+}
+
+// indexUndo restores key in the keydir of typ to old, or removes it if old is
+// nil
+type indexUndo struct {
+	typ uint16
+	key []byte
+	old *Pos
+}
+
+// write runs fn as part of a write group and waits for the fsync the sync
+// policy or sync asks for
+func (db *TinyDB) write(sync bool, fn func() error) error {
+	req := &writeRequest{sync: sync, fn: fn, ready: make(chan struct{})}
+
+	p := &db.pipeline
+	p.mu.Lock()
+	p.queue = append(p.queue, req)
+	lead := !p.leading
+	p.leading = true
+	p.mu.Unlock()
+
+	if !lead {
+		<-req.ready
+		if req.done {
+			return req.err
+		}
+	}
+
+	db.lead()
+	return req.err
+}
+
+// lead commits the head of the queue, which is the leader's own request
+func (db *TinyDB) lead() {
+	p := &db.pipeline
+	p.mu.Lock()
+	n := len(p.queue)
+	if n > maxWriteGroup {
+		n = maxWriteGroup
+	}
+	group := p.queue[:n:n]
+	p.queue = p.queue[n:]
+	p.mu.Unlock()
+
+	db.mu.Lock()
+	ticket, wrote, force := db.commitGroup(group)
+	db.mu.Unlock()
+
+	p.mu.Lock()
+	if len(p.queue) > 0 {
+		close(p.queue[0].ready)
+	} else {
+		p.leading = false
+	}
+	p.mu.Unlock()
+
+	if wrote {
+		if err := db.syncer.afterWrite(ticket, force); err != nil {
+			for _, req := range group {
+				if req.err == nil {
+					req.err = err
+				}
+			}
+		}
+	}
+
+	for _, req := range group[1:] {
+		req.done = true
+		close(req.ready)
+	}
+}
+
+// commitGroup runs the requests of group and flushes what they appended, it
+// returns the ticket to sync up to, whether any request succeeded and whether
+// one of those asked for a sync. The caller must hold db.mu.
+func (db *TinyDB) commitGroup(group []*writeRequest) (ticket uint64, wrote, force bool) {
+	if db.closed {
+		for _, req := range group {
+			req.err = ErrDBClosed
+		}
+		return
+	}
+
+	for _, req := range group {
+		db.wbuf.req = req
+		req.err = req.fn()
+	}
+	db.wbuf.req = nil
+	db.flush()
+
+	for _, req := range group {
+		if req.err == nil {
+			wrote = true
+			force = force || req.sync
+		}
+	}
+	return db.syncer.ticket(), wrote, force
+}
+
+// buffer encodes e straight into the write buffer and returns where it lands
+// in the active file, the caller must hold db.mu
+func (db *TinyDB) buffer(e *Entry) (*Pos, error) {
+	wb := &db.wbuf
+	pos := &Pos{
+		FileID:    db.activeFile.FileID,
+		Offset:    db.activeFile.Offset + int64(len(wb.buf)),
+		Size:      e.Size(),
+		ExpiresAt: e.ExpiresAt,
+		Seq:       e.Seq,
+	}
+
+	buf, err := e.AppendEncode(wb.buf)
+	if err != nil {
+		return nil, err
+	}
+	wb.buf = buf
+
+	if req := wb.req; req != nil {
+		req.pos = append(req.pos, pos)
+		if n := len(wb.pending); n == 0 || wb.pending[n-1] != req {
+			wb.pending = append(wb.pending, req)
+		}
+	}
+	return pos, nil
+}
+
+// recordUndo remembers the index entry of key before a buffered write changes
+// it, the caller must hold db.mu
+func (db *TinyDB) recordUndo(typ uint16, key []byte) {
+	if db.wbuf.req == nil {
+		return
+	}
+	old, _ := db.keydir(typ).Get(key)
+	db.wbuf.undo = append(db.wbuf.undo, indexUndo{typ: typ, key: key, old: old})
+}
+
+// flush appends the write buffer to the active file with a single write. If
+// that fails the file is cut back and the index changes of the buffered
+// entries are undone, their requests fail with the error. The caller must hold
+// db.mu.
+func (db *TinyDB) flush() error {
+	wb := &db.wbuf
+	if len(wb.buf) == 0 {
+		return nil
+	}
+
+	offset := db.activeFile.Offset
+	err := db.activeFile.writeRaw(wb.buf)
+	if err == nil {
+		db.syncer.wrote(int64(len(wb.buf)))
+	} else {
+		db.rollback(offset, err)
+	}
+
+	if cap(wb.buf) > maxWriteBuffer {
+		wb.buf = nil
+	}
+	wb.buf = wb.buf[:0]
+	wb.pending = wb.pending[:0]
+	wb.undo = wb.undo[:0]
+	return err
+}
+
+// rollback undoes the write buffer after its append at offset failed
+func (db *TinyDB) rollback(offset int64, err error) {
+	wb := &db.wbuf
+	if terr := db.activeFile.Truncate(offset); terr != nil {
+		db.logf("rollback write group err: %v\n", terr)
+	}
+
+	req := wb.req
+	wb.req = nil
+	fids := []uint32{db.activeFile.FileID}
+	for i := len(wb.undo) - 1; i >= 0; i-- {
+		u := wb.undo[i]
+		kd := db.typedKeydir(u.typ)
+		switch {
+		case u.old == nil && kd == nil:
+			db.indexDelete(u.key)
+		case u.old == nil:
+			kd.Delete(u.key)
+		case kd == nil:
+			db.indexPut(u.key, u.old)
+		default:
+			kd.Put(u.key, u.old)
+		}
+		if u.old != nil {
+			fids = append(fids, u.old.FileID)
+		}
+		if u.typ == ZSet && u.old != nil {
+			if err := db.loadZSetMember(u.key); err != nil {
+				db.logf("rollback sorted set member err: %v\n", err)
+			}
+		}
+	}
+	wb.req = req
+	db.resetDeadBytes(fids...)
+
+	for _, req := range wb.pending {
+		req.err = err
+		req.pos = nil
+	}
+}
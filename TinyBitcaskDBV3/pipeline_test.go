@@ -0,0 +1,260 @@
+package TinyBitcaskDBV3
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestWritePipeline_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, WithMaxFileSize(4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 30; i++ {
+				key := []byte(fmt.Sprintf("pipeline_key_%d_%d", g, i))
+				var err error
+				switch i % 3 {
+				case 0:
+					err = db.Put(key, []byte("pipeline_value"))
+				case 1:
+					wb := db.NewWriteBatch()
+					wb.Put(key, []byte("pipeline_value"))
+					wb.Put([]byte(fmt.Sprintf("pipeline_key_%d_%d", g, i-1)), nil)
+					err = wb.Commit()
+				case 2:
+					if err = db.Put(key, []byte("pipeline_value")); err == nil {
+						err = db.Del(key)
+					}
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	check := func(db *TinyDB) {
+		for g := 0; g < 16; g++ {
+			for i := 0; i < 30; i++ {
+				key := []byte(fmt.Sprintf("pipeline_key_%d_%d", g, i))
+				v, err := db.Get(key)
+				switch i % 3 {
+				case 0:
+					if err != nil || len(v) != 0 {
+						t.Fatalf("Expected %s to be emptied by the batch, got %s, err: %v", key, v, err)
+					}
+				case 1:
+					if err != nil || string(v) != "pipeline_value" {
+						t.Fatalf("Expected pipeline_value for %s, got %s, err: %v", key, v, err)
+					}
+				case 2:
+					if err != ErrKeyNotFound {
+						t.Fatalf("Expected %s to be deleted, got %s, err: %v", key, v, err)
+					}
+				}
+			}
+		}
+	}
+
+	check(db)
+	db.Close()
+	if db, err = Open(dir, WithMaxFileSize(4096)); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(db)
+}
+
+func TestWritePipeline_Group(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// pose as a leader so the writers queue up behind it
+	p := &db.pipeline
+	p.mu.Lock()
+	p.leading = true
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := db.Put([]byte(fmt.Sprintf("group_key_%d", i)), []byte("group_value")); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+
+	var queue []*writeRequest
+	for len(queue) < 10 {
+		p.mu.Lock()
+		queue = append([]*writeRequest(nil), p.queue...)
+		p.mu.Unlock()
+	}
+	written, _ := syncState(db)
+
+	p.mu.Lock()
+	close(p.queue[0].ready)
+	p.mu.Unlock()
+	wg.Wait()
+
+	if w, _ := syncState(db); w != written+1 {
+		t.Fatalf("Expected the 10 writes to be flushed at once, got %d flushes", w-written)
+	}
+	offsets := make(map[int64]bool)
+	for _, req := range queue {
+		if req.err != nil || len(req.pos) != 1 || offsets[req.pos[0].Offset] {
+			t.Fatalf("Expected every writer to get its own offset, got %v, err: %v", req.pos, req.err)
+		}
+		offsets[req.pos[0].Offset] = true
+	}
+	for i := 0; i < 10; i++ {
+		if v, err := db.Get([]byte(fmt.Sprintf("group_key_%d", i))); err != nil || string(v) != "group_value" {
+			t.Fatalf("Expected group_value, got %s, err: %v", v, err)
+		}
+	}
+}
+
+// queueWriters runs n writers while db.mu is held: the first one leads and
+// waits for the lock with a group of its own, the others queue up behind it.
+// Once all of them wait the lock is released. It returns what every writer got.
+func queueWriters(t *testing.T, db *TinyDB, n int, write func(i int) error) []error {
+	t.Helper()
+	p := &db.pipeline
+	queued := func(leading bool, waiting int) bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.leading == leading && len(p.queue) == waiting
+	}
+
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	start := func(i int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = write(i)
+		}()
+	}
+
+	db.mu.Lock()
+	start(0)
+	for !queued(true, 0) {
+		runtime.Gosched()
+	}
+	for i := 1; i < n; i++ {
+		start(i)
+	}
+	for !queued(true, n-1) {
+		runtime.Gosched()
+	}
+	db.mu.Unlock()
+	wg.Wait()
+	return errs
+}
+
+func TestWritePipeline_HeldLock(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// every odd writer pops a missing list and fails on its own
+	const n = 20
+	written, _ := syncState(db)
+	errs := queueWriters(t, db, n, func(i int) error {
+		if i%2 == 1 {
+			_, err := db.LPop([]byte(fmt.Sprintf("held_list_%d", i)))
+			return err
+		}
+		return db.Put([]byte(fmt.Sprintf("held_key_%d", i)), []byte(fmt.Sprintf("held_value_%d", i)))
+	})
+
+	// the leader's group of one, then the other writers at once
+	if w, _ := syncState(db); w-written != 2 {
+		t.Fatalf("Expected %d writes to share 2 flushes, got %d", n, w-written)
+	}
+	for i, err := range errs {
+		if i%2 == 1 {
+			if err != ErrKeyNotFound {
+				t.Fatalf("Expected ErrKeyNotFound for writer %d, got %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Expected writer %d to succeed, got %v", i, err)
+		}
+		if v, err := db.Get([]byte(fmt.Sprintf("held_key_%d", i))); err != nil || string(v) != fmt.Sprintf("held_value_%d", i) {
+			t.Fatalf("Expected held_value_%d, got %s, err: %v", i, v, err)
+		}
+	}
+}
+
+func TestWritePipeline_Rollback(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Put([]byte("rollback_key"), []byte("old_value")); err != nil {
+		t.Fatal(err)
+	}
+	offset := db.activeFile.Offset
+
+	// a handle that cannot be written makes the flush fail
+	file := db.activeFile.File
+	readOnly, err := os.Open(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.activeFile.File = readOnly
+	if err := db.Put([]byte("rollback_key"), []byte("new_value")); err == nil {
+		t.Fatal("Expected the write to fail")
+	}
+	wb := db.NewWriteBatch()
+	wb.Put([]byte("rollback_new_key"), []byte("new_value"))
+	wb.Delete([]byte("rollback_key"))
+	if err := wb.Commit(); err == nil {
+		t.Fatal("Expected the batch to fail")
+	}
+	db.activeFile.File = file
+	readOnly.Close()
+
+	if db.activeFile.Offset != offset {
+		t.Fatalf("Expected the offset to stay at %d, got %d", offset, db.activeFile.Offset)
+	}
+	if v, err := db.Get([]byte("rollback_key")); err != nil || string(v) != "old_value" {
+		t.Fatalf("Expected old_value, got %s, err: %v", v, err)
+	}
+	if v, err := db.Get([]byte("rollback_new_key")); err != ErrKeyNotFound {
+		t.Fatalf("Expected rollback_new_key to be rolled back, got %s, err: %v", v, err)
+	}
+	if dead := db.deadBytes[db.activeFile.FileID]; dead != 0 {
+		t.Fatalf("Expected no dead bytes, got %d", dead)
+	}
+
+	if err := db.Put([]byte("rollback_key"), []byte("new_value")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.Get([]byte("rollback_key")); err != nil || string(v) != "new_value" {
+		t.Fatalf("Expected new_value, got %s, err: %v", v, err)
+	}
+}
@@ -0,0 +1,217 @@
+package TinyBitcaskDBV3
+
+import (
+	"bytes"
+	"sort"
+)
+
+// setKey is the record key of member of the set at key
+func setKey(key, member []byte) []byte {
+	return encodeSubKey(key, member)
+}
+
+// SAdd adds members to the set at key with a single batch and returns how many
+// of them were new. A member is a record without value, SRem writes a
+// tombstone for it.
+func (db *TinyDB) SAdd(key []byte, members ...[]byte) (int, error) {
+	return db.updateSet(key, members, Put)
+}
+
+// SRem removes members from the set at key and returns how many of them were
+// in it
+func (db *TinyDB) SRem(key []byte, members ...[]byte) (int, error) {
+	return db.updateSet(key, members, Delete)
+}
+
+func (db *TinyDB) updateSet(key []byte, members [][]byte, mark uint16) (n int, err error) {
+	if err = db.checkWrite(key, nil); err != nil {
+		return
+	}
+	for _, member := range members {
+		if err = db.checkMember(key, member, nil); err != nil {
+			return
+		}
+	}
+
+	err = db.write(false, func() error {
+		if mark == Delete {
+			if err := db.checkType(key, Set); err != nil {
+				return err
+			}
+		}
+		current := db.sets.members(key)
+		seen := make(map[string]bool, len(members))
+		var entries []*Entry
+		for _, member := range members {
+			// skip members that are already in, or already out of, the set
+			if _, ok := current[string(member)]; ok == (mark == Put) || seen[string(member)] {
+				continue
+			}
+			seen[string(member)] = true
+			entries = append(entries, NewEntry(setKey(key, member), nil, mark, Set))
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		if err := db.writeRecords(entries); err != nil {
+			return err
+		}
+		n = len(entries)
+		return nil
+	})
+	return
+}
+
+// SIsMember reports whether member is in the set at key
+func (db *TinyDB) SIsMember(key, member []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, ErrEmptyKey
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return false, ErrDBClosed
+	}
+	if err := db.checkType(key, Set); err != nil {
+		return false, err
+	}
+	_, ok := db.sets.members(key)[string(member)]
+	return ok, nil
+}
+
+// SMembers returns the members of the set at key in ascending order
+func (db *TinyDB) SMembers(key []byte) ([][]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+	if err := db.checkType(key, Set); err != nil {
+		return nil, err
+	}
+	return db.sets.sortedMembers(key), nil
+}
+
+// SCard returns the number of members of the set at key
+func (db *TinyDB) SCard(key []byte) (int, error) {
+	if len(key) == 0 {
+		return 0, ErrEmptyKey
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return 0, ErrDBClosed
+	}
+	if err := db.checkType(key, Set); err != nil {
+		return 0, err
+	}
+	return len(db.sets.members(key)), nil
+}
+
+// SPop removes and returns an arbitrary member of the set at key
+func (db *TinyDB) SPop(key []byte) (member []byte, err error) {
+	if err = db.checkWrite(key, nil); err != nil {
+		return
+	}
+
+	err = db.write(false, func() error {
+		if err := db.checkType(key, Set); err != nil {
+			return err
+		}
+		for m := range db.sets.members(key) {
+			member = []byte(m)
+			return db.writeRecord(NewEntry(setKey(key, member), nil, Delete, Set))
+		}
+		return ErrKeyNotFound
+	})
+	return
+}
+
+// SUnion returns the members that are in any of the sets at keys
+func (db *TinyDB) SUnion(keys ...[]byte) ([][]byte, error) {
+	return db.combineSets(keys, func(members map[string]bool) {
+		for _, key := range keys {
+			for member := range db.sets.members(key) {
+				members[member] = true
+			}
+		}
+	})
+}
+
+// SInter returns the members that are in every one of the sets at keys
+func (db *TinyDB) SInter(keys ...[]byte) ([][]byte, error) {
+	return db.combineSets(keys, func(members map[string]bool) {
+		for member := range db.sets.members(keys[0]) {
+			if db.countSets(keys[1:], member) == len(keys)-1 {
+				members[member] = true
+			}
+		}
+	})
+}
+
+// SDiff returns the members of the first set at keys that are in none of the
+// others
+func (db *TinyDB) SDiff(keys ...[]byte) ([][]byte, error) {
+	return db.combineSets(keys, func(members map[string]bool) {
+		for member := range db.sets.members(keys[0]) {
+			if db.countSets(keys[1:], member) == 0 {
+				members[member] = true
+			}
+		}
+	})
+}
+
+// combineSets runs fn to collect members from the sets at keys and returns
+// them in ascending order
+func (db *TinyDB) combineSets(keys [][]byte, fn func(members map[string]bool)) ([][]byte, error) {
+	if len(keys) == 0 {
+		return nil, ErrEmptyKey
+	}
+	for _, key := range keys {
+		if len(key) == 0 {
+			return nil, ErrEmptyKey
+		}
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+	for _, key := range keys {
+		if err := db.checkType(key, Set); err != nil {
+			return nil, err
+		}
+	}
+
+	members := make(map[string]bool)
+	fn(members)
+
+	out := make([][]byte, 0, len(members))
+	for member := range members {
+		out = append(out, []byte(member))
+	}
+	sort.Slice(out, func(i, j int) bool { return bytes.Compare(out[i], out[j]) < 0 })
+	return out, nil
+}
+
+// countSets returns how many of the sets at keys contain member
+func (db *TinyDB) countSets(keys [][]byte, member string) int {
+	var n int
+	for _, key := range keys {
+		if _, ok := db.sets.members(key)[member]; ok {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,130 @@
+package TinyBitcaskDBV3
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func checkMembers(t *testing.T, name string, members [][]byte, err error, expected ...string) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != len(expected) || (len(members) > 0 && !reflect.DeepEqual(members, listValues(expected...))) {
+		t.Fatalf("Expected %s to be %q, got %q", name, expected, members)
+	}
+}
+
+func TestSet(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	key := []byte("set_key")
+	if n, err := db.SAdd(key, listValues("a", "b", "c", "a")...); err != nil || n != 3 {
+		t.Fatalf("Expected 3 members added, got %d, err: %v", n, err)
+	}
+	if n, err := db.SAdd(key, listValues("c", "d")...); err != nil || n != 1 {
+		t.Fatalf("Expected 1 member added, got %d, err: %v", n, err)
+	}
+	if ok, err := db.SIsMember(key, []byte("b")); err != nil || !ok {
+		t.Fatalf("Expected b to be a member, err: %v", err)
+	}
+	if n, err := db.SRem(key, listValues("b", "x")...); err != nil || n != 1 {
+		t.Fatalf("Expected 1 member removed, got %d, err: %v", n, err)
+	}
+	if ok, _ := db.SIsMember(key, []byte("b")); ok {
+		t.Fatal("Expected b to be removed")
+	}
+	members, err := db.SMembers(key)
+	checkMembers(t, "SMembers", members, err, "a", "c", "d")
+	if n, err := db.SCard(key); err != nil || n != 3 {
+		t.Fatalf("Expected 3 members, got %d, err: %v", n, err)
+	}
+
+	popped := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		m, err := db.SPop(key)
+		if err != nil || popped[string(m)] {
+			t.Fatalf("Expected a new member, got %s, err: %v", m, err)
+		}
+		popped[string(m)] = true
+	}
+	if _, err := db.SPop(key); err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+	if n, err := db.SCard(key); err != nil || n != 0 {
+		t.Fatalf("Expected an empty set, got %d, err: %v", n, err)
+	}
+}
+
+func TestSet_Algebra(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	db.SAdd([]byte("set_1"), listValues("a", "b", "c", "d")...)
+	db.SAdd([]byte("set_2"), listValues("c", "d", "e")...)
+	db.SAdd([]byte("set_3"), listValues("a", "c", "e", "f")...)
+
+	members, err := db.SUnion([]byte("set_1"), []byte("set_2"), []byte("set_3"), []byte("missing"))
+	checkMembers(t, "SUnion", members, err, "a", "b", "c", "d", "e", "f")
+	members, err = db.SInter([]byte("set_1"), []byte("set_2"), []byte("set_3"))
+	checkMembers(t, "SInter", members, err, "c")
+	members, err = db.SInter([]byte("set_1"), []byte("set_1"))
+	checkMembers(t, "SInter of a set with itself", members, err, "a", "b", "c", "d")
+	members, err = db.SInter([]byte("set_1"), []byte("missing"))
+	checkMembers(t, "SInter with a missing set", members, err)
+	members, err = db.SDiff([]byte("set_1"), []byte("set_2"), []byte("set_3"))
+	checkMembers(t, "SDiff", members, err, "b")
+	members, err = db.SDiff([]byte("set_3"), []byte("set_1"))
+	checkMembers(t, "SDiff", members, err, "e", "f")
+	if _, err := db.SUnion(); err != ErrEmptyKey {
+		t.Fatalf("Expected ErrEmptyKey, got %v", err)
+	}
+}
+
+func TestSet_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, WithMaxFileSize(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := []byte("reopen_set")
+	for i := 0; i < 30; i++ {
+		db.SAdd(key, []byte(fmt.Sprintf("member_%02d", i%12)))
+		if i%3 == 0 {
+			db.SRem(key, []byte(fmt.Sprintf("member_%02d", i%12)))
+		}
+	}
+
+	check := func(db *TinyDB) {
+		t.Helper()
+		members, err := db.SMembers(key)
+		checkMembers(t, "SMembers", members, err, "member_01", "member_02", "member_04", "member_05", "member_07", "member_08", "member_10", "member_11")
+	}
+
+	check(db)
+	db.Close()
+	if db, err = Open(dir, WithMaxFileSize(512)); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+	db.Close()
+	if db, err = Open(dir, WithMaxFileSize(512)); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(db)
+}
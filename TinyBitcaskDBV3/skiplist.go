@@ -0,0 +1,182 @@
+package TinyBitcaskDBV3
+
+import (
+	"math/rand"
+)
+
+const (
+	skipListMaxLevel = 32
+	skipListP        = 0.25
+)
+
+// skipList orders the members of a sorted set by score, then member. Every
+// link knows how many nodes it skips, so ranks are found in O(log n).
+type skipList struct {
+	head   *skipListNode
+	tail   *skipListNode
+	length int
+	level  int
+}
+
+type skipListNode struct {
+	member   string
+	score    float64
+	backward *skipListNode
+	level    []skipListLevel
+}
+
+type skipListLevel struct {
+	forward *skipListNode
+	span    int
+}
+
+func newSkipList() *skipList {
+	return &skipList{head: newSkipListNode(skipListMaxLevel, 0, ""), level: 1}
+}
+
+func newSkipListNode(level int, score float64, member string) *skipListNode {
+	return &skipListNode{member: member, score: score, level: make([]skipListLevel, level)}
+}
+
+func randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel && rand.Float64() < skipListP {
+		level++
+	}
+	return level
+}
+
+// before reports whether n sorts before score and member
+func (n *skipListNode) before(score float64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+// insert adds member with score, the caller makes sure it is not in the list
+func (l *skipList) insert(score float64, member string) {
+	var (
+		update [skipListMaxLevel]*skipListNode
+		rank   [skipListMaxLevel]int
+	)
+
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		if i < l.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && x.level[i].forward.before(score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := randomLevel()
+	if level > l.level {
+		for i := l.level; i < level; i++ {
+			update[i] = l.head
+			update[i].level[i].span = l.length
+		}
+		l.level = level
+	}
+
+	x = newSkipListNode(level, score, member)
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < l.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != l.head {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		l.tail = x
+	}
+	l.length++
+}
+
+// delete removes member with score and reports whether it was there
+func (l *skipList) delete(score float64, member string) bool {
+	var update [skipListMaxLevel]*skipListNode
+
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && x.level[i].forward.before(score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.level[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+
+	for i := 0; i < l.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		l.tail = x.backward
+	}
+	for l.level > 1 && l.head.level[l.level-1].forward == nil {
+		l.level--
+	}
+	l.length--
+	return true
+}
+
+// rank returns the 0 based position of member with score, -1 if it is missing
+func (l *skipList) rank(score float64, member string) int {
+	var rank int
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && (x.level[i].forward.before(score, member) || x.level[i].forward.member == member && x.level[i].forward.score == score) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		if x != l.head && x.member == member && x.score == score {
+			return rank - 1
+		}
+	}
+	return -1
+}
+
+// byRank returns the node at the 0 based position rank, nil if out of range
+func (l *skipList) byRank(rank int) *skipListNode {
+	var traversed int
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank+1 {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank+1 {
+			return x
+		}
+	}
+	return nil
+}
+
+// firstFrom returns the first node with a score of at least min
+func (l *skipList) firstFrom(min float64) *skipListNode {
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && x.level[i].forward.score < min {
+			x = x.level[i].forward
+		}
+	}
+	return x.level[0].forward
+}
@@ -0,0 +1,78 @@
+package TinyBitcaskDBV3
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSkipList_RandomOps(t *testing.T) {
+	l := newSkipList()
+	scores := make(map[string]float64)
+	r := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 5000; i++ {
+		member := fmt.Sprintf("member_%d", r.Intn(300))
+		if old, ok := scores[member]; ok {
+			if !l.delete(old, member) {
+				t.Fatalf("Expected %s to be deleted", member)
+			}
+			delete(scores, member)
+		}
+		if r.Intn(3) > 0 {
+			score := float64(r.Intn(50))
+			l.insert(score, member)
+			scores[member] = score
+		}
+	}
+
+	type item struct {
+		member string
+		score  float64
+	}
+	var sorted []item
+	for member, score := range scores {
+		sorted = append(sorted, item{member, score})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].score != sorted[j].score {
+			return sorted[i].score < sorted[j].score
+		}
+		return sorted[i].member < sorted[j].member
+	})
+
+	if l.length != len(sorted) {
+		t.Fatalf("Expected %d members, got %d", len(sorted), l.length)
+	}
+	for i, it := range sorted {
+		if rank := l.rank(it.score, it.member); rank != i {
+			t.Fatalf("Expected rank %d for %s, got %d", i, it.member, rank)
+		}
+		if x := l.byRank(i); x == nil || x.member != it.member {
+			t.Fatalf("Expected %s at rank %d, got %v", it.member, i, x)
+		}
+	}
+	if l.byRank(len(sorted)) != nil || l.rank(100, "missing") != -1 {
+		t.Fatal("Expected nothing past the last member")
+	}
+
+	if x := l.firstFrom(25); x != nil {
+		i := sort.Search(len(sorted), func(i int) bool { return sorted[i].score >= 25 })
+		if x.member != sorted[i].member {
+			t.Fatalf("Expected %s to be the first with score 25, got %s", sorted[i].member, x.member)
+		}
+	}
+
+	// walk backwards from the tail
+	i := len(sorted) - 1
+	for x := l.tail; x != nil; x = x.backward {
+		if x.member != sorted[i].member {
+			t.Fatalf("Expected %s at %d walking backwards, got %s", sorted[i].member, i, x.member)
+		}
+		i--
+	}
+	if i != -1 {
+		t.Fatalf("Expected to walk back %d members, stopped at %d", len(sorted), i)
+	}
+}
@@ -0,0 +1,155 @@
+package TinyBitcaskDBV3
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// SyncPolicy decides when writes are fsynced to disk
+type SyncPolicy uint8
+
+const (
+	SyncNever    SyncPolicy = iota // leave it to the OS, Sync and Close still fsync
+	SyncAlways                     // every write returns once it is on disk
+	SyncInterval                   // a background flusher fsyncs every Options.SyncInterval
+	SyncBytes                      // fsync once Options.SyncBytes were written since the last one
+)
+
+// PutOptions overrides the sync policy for a single write
+type PutOptions struct {
+	Sync bool // return only once the write is on disk
+}
+
+// syncer tracks the appends to the active file and fsyncs them. Every flush
+// of the write pipeline gets a ticket, callers that wait for their ticket at
+// the same time share a single File.Sync done by whoever comes first.
+type syncer struct {
+	db      *TinyDB
+	mu      sync.Mutex
+	cond    *sync.Cond
+	syncing bool
+
+	written      uint64 // tickets handed out
+	writtenBytes int64
+	synced       uint64 // tickets known to be on disk
+	syncedBytes  int64
+	syncs        uint64 // File.Sync calls
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newSyncer(db *TinyDB) *syncer {
+	s := &syncer{db: db}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// wrote records an append of size bytes and returns its ticket
+func (s *syncer) wrote(size int64) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.written++
+	s.writtenBytes += size
+	return s.written
+}
+
+// ticket returns the ticket of the last write
+func (s *syncer) ticket() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.written
+}
+
+// afterWrite fsyncs up to ticket if force is set or the sync policy asks for it
+func (s *syncer) afterWrite(ticket uint64, force bool) error {
+	opts := s.db.opts
+
+	s.mu.Lock()
+	need := force || opts.SyncPolicy == SyncAlways ||
+		(opts.SyncPolicy == SyncBytes && s.writtenBytes-s.syncedBytes >= opts.SyncBytes)
+	s.mu.Unlock()
+
+	if !need {
+		return nil
+	}
+	return s.wait(ticket)
+}
+
+// wait returns once every write up to ticket is on disk
+func (s *syncer) wait(ticket uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for s.synced < ticket {
+		if s.syncing {
+			s.cond.Wait()
+			continue
+		}
+
+		s.syncing = true
+		target, targetBytes := s.written, s.writtenBytes
+		s.mu.Unlock()
+		err := s.db.syncActive()
+		s.mu.Lock()
+		s.syncing = false
+		s.syncs++
+		s.cond.Broadcast()
+
+		if err != nil {
+			return err
+		}
+		if target > s.synced {
+			s.synced, s.syncedBytes = target, targetBytes
+		}
+	}
+	return nil
+}
+
+// start runs the background flusher of SyncInterval
+func (s *syncer) start(interval time.Duration) {
+	s.stop = make(chan struct{})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				if err := s.wait(s.ticket()); err != nil {
+					s.db.logf("background sync err: %v\n", err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *syncer) close() {
+	if s.stop != nil {
+		close(s.stop)
+		s.wg.Wait()
+		s.stop = nil
+	}
+}
+
+// syncActive fsyncs the active file. Files that stopped being active were
+// synced by rotate and Close, so a file closed under us is already on disk.
+func (db *TinyDB) syncActive() error {
+	db.mu.RLock()
+	dbFile, closed := db.activeFile, db.closed
+	db.mu.RUnlock()
+
+	if closed {
+		return nil
+	}
+	if err := dbFile.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package TinyBitcaskDBV3
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func syncState(db *TinyDB) (written, synced uint64) {
+	db.syncer.mu.Lock()
+	defer db.syncer.mu.Unlock()
+	return db.syncer.written, db.syncer.synced
+}
+
+func TestSyncPolicy(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Put([]byte("sync_key"), []byte("sync_value")); err != nil {
+		t.Fatal(err)
+	}
+	if written, synced := syncState(db); written != 1 || synced != 0 {
+		t.Fatalf("Expected SyncNever to leave the write unsynced, got %d/%d", synced, written)
+	}
+	if err := db.PutWithOptions([]byte("sync_key"), []byte("sync_value"), PutOptions{Sync: true}); err != nil {
+		t.Fatal(err)
+	}
+	if written, synced := syncState(db); written != 2 || synced != 2 {
+		t.Fatalf("Expected PutOptions.Sync to fsync, got %d/%d", synced, written)
+	}
+	db.Close()
+
+	db, err = Open(t.TempDir(), WithSyncBytes(200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put([]byte("sync_key"), []byte("sync_value"))
+	if written, synced := syncState(db); synced != 0 {
+		t.Fatalf("Expected no fsync below SyncBytes, got %d/%d", synced, written)
+	}
+	for i := 0; i < 5; i++ {
+		db.Put([]byte("sync_key"), []byte("sync_value"))
+	}
+	if written, synced := syncState(db); synced == 0 || written-synced > 3 {
+		t.Fatalf("Expected an fsync every 200 bytes, got %d/%d", synced, written)
+	}
+	db.Close()
+
+	db, err = Open(t.TempDir(), WithSyncInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.Put([]byte("sync_key"), []byte("sync_value"))
+	deadline := time.Now().Add(time.Second)
+	for {
+		written, synced := syncState(db)
+		if synced == written {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the flusher to fsync, got %d/%d", synced, written)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSyncAlways_GroupCommit(t *testing.T) {
+	db, err := Open(t.TempDir(), WithSyncPolicy(SyncAlways))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// 160 writers behind a held lock commit in groups of at most
+	// maxWriteGroup: the leader's own, then 128, then 31
+	errs := queueWriters(t, db, 160, func(i int) error {
+		return db.Put([]byte(fmt.Sprintf("group_key_%d", i)), []byte("group_value"))
+	})
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Expected writer %d to succeed, got %v", i, err)
+		}
+	}
+
+	written, synced := syncState(db)
+	if written != 3 || synced != written || db.syncer.syncs > 3 {
+		t.Fatalf("Expected 160 writes in 3 groups with at most 3 fsyncs, got %d/%d with %d fsyncs", synced, written, db.syncer.syncs)
+	}
+
+	// writers that wait while an fsync is in flight share the next one
+	s := db.syncer
+	s.mu.Lock()
+	s.syncing = true
+	s.written += 5
+	target := s.written
+	s.mu.Unlock()
+
+	var waiters sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		waiters.Add(1)
+		go func(ticket uint64) {
+			defer waiters.Done()
+			if err := s.wait(ticket); err != nil {
+				t.Error(err)
+			}
+		}(target - uint64(i))
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	s.mu.Lock()
+	syncs := s.syncs
+	s.syncing = false
+	s.synced = target
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	waiters.Wait()
+
+	if s.syncs != syncs {
+		t.Fatalf("Expected the waiters to share the fsync in flight, got %d extra", s.syncs-syncs)
+	}
+}
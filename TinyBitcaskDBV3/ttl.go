@@ -0,0 +1,176 @@
+package TinyBitcaskDBV3
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTTLSweepInterval = time.Second
+)
+
+// NoExpiry is returned by TTL for a key without expiry
+const NoExpiry time.Duration = -1
+
+var (
+	ErrInvalidTTL = errors.New("ttl must be positive")
+)
+
+// PutWithTTL sets key to value, the key is gone once ttl has passed
+func (db *TinyDB) PutWithTTL(key, value []byte, ttl time.Duration) error {
+	if err := db.checkWrite(key, value); err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+
+	return db.write(false, func() error {
+		return db.put(key, value, time.Now().Add(ttl).UnixNano())
+	})
+}
+
+// Expire sets the TTL of an existing key
+func (db *TinyDB) Expire(key []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	return db.rewriteExpiry(key, time.Now().Add(ttl).UnixNano())
+}
+
+// Persist removes the TTL of an existing key
+func (db *TinyDB) Persist(key []byte) error {
+	return db.rewriteExpiry(key, 0)
+}
+
+// TTL returns the time key has left, NoExpiry if it never expires
+func (db *TinyDB) TTL(key []byte) (time.Duration, error) {
+	if len(key) == 0 {
+		return 0, ErrEmptyKey
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return 0, ErrDBClosed
+	}
+	if err := db.checkType(key, String); err != nil {
+		return 0, err
+	}
+
+	pos, ok := db.lookup(key)
+	if !ok {
+		return 0, ErrKeyNotFound
+	}
+	if pos.ExpiresAt == 0 {
+		return NoExpiry, nil
+	}
+	return time.Duration(pos.ExpiresAt - time.Now().UnixNano()), nil
+}
+
+// rewriteExpiry appends the current value of key again with a new expiry,
+// the data files only ever learn about a changed TTL through a new entry
+func (db *TinyDB) rewriteExpiry(key []byte, expiresAt int64) error {
+	if err := db.checkWrite(key, nil); err != nil {
+		return err
+	}
+
+	return db.write(false, func() error {
+		if err := db.checkType(key, String); err != nil {
+			return err
+		}
+		return db.putExpiry(key, expiresAt)
+	})
+}
+
+// putExpiry is rewriteExpiry with db.mu held
+func (db *TinyDB) putExpiry(key []byte, expiresAt int64) error {
+	pos, ok := db.lookup(key)
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if pos.ExpiresAt == expiresAt {
+		return nil
+	}
+
+	e, err := db.readEntry(pos)
+	if err != nil {
+		return err
+	}
+
+	return db.put(key, e.Meta.Value, expiresAt)
+}
+
+// ttlSweeper drops expired keys from the index in the background, so keys
+// that are never read again do not linger until the next Open
+type ttlSweeper struct {
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (db *TinyDB) startTTLSweeper(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ts := &ttlSweeper{stop: make(chan struct{})}
+	db.ttlSweeper = ts
+
+	ts.wg.Add(1)
+	go func() {
+		defer ts.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ts.stop:
+				return
+			case <-ticker.C:
+				db.sweepExpired()
+			}
+		}
+	}()
+}
+
+func (db *TinyDB) stopTTLSweeper() {
+	db.mu.Lock()
+	ts := db.ttlSweeper
+	db.ttlSweeper = nil
+	db.mu.Unlock()
+
+	if ts != nil {
+		close(ts.stop)
+		ts.wg.Wait()
+	}
+}
+
+// sweepExpired removes every expired key from the index. No tombstone is
+// needed, the expiry in the entry hides it from the next Open as well.
+func (db *TinyDB) sweepExpired() int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return 0
+	}
+
+	var n int
+	now := time.Now().UnixNano()
+	for key, expiresAt := range db.ttlKeys {
+		if expiresAt > now {
+			continue
+		}
+		if pos, ok := db.indexDelete([]byte(key)); ok {
+			db.markDead(pos)
+			n++
+		}
+	}
+
+	if n > 0 {
+		db.logf("swept %d expired keys\n", n)
+	}
+	return n
+}
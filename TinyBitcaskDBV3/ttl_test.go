@@ -0,0 +1,156 @@
+package TinyBitcaskDBV3
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTinyDB_PutWithTTL(t *testing.T) {
+	db, err := Open(t.TempDir(), WithTTLSweepInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.PutWithTTL([]byte("ttl_key"), []byte("ttl_value"), 0); err != ErrInvalidTTL {
+		t.Fatalf("Expected ErrInvalidTTL, got %v", err)
+	}
+	if err := db.PutWithTTL([]byte("ttl_key"), []byte("ttl_value"), 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.Get([]byte("ttl_key")); err != nil || string(v) != "ttl_value" {
+		t.Fatalf("Expected ttl_value, got %s, err: %v", v, err)
+	}
+	if ttl, err := db.TTL([]byte("ttl_key")); err != nil || ttl <= 0 || ttl > 50*time.Millisecond {
+		t.Fatalf("Expected TTL in (0, 50ms], got %v, err: %v", ttl, err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := db.Get([]byte("ttl_key")); err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound after expiry, got %v", err)
+	}
+	if _, err := db.TTL([]byte("ttl_key")); err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound from TTL after expiry, got %v", err)
+	}
+	if err := db.Scan(nil, func(key, value []byte) bool {
+		t.Fatalf("Expected Scan to skip the expired key, got %s", key)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTinyDB_ExpireAndPersist(t *testing.T) {
+	db, err := Open(t.TempDir(), WithTTLSweepInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Expire([]byte("missing"), time.Second); err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	if err := db.Put([]byte("expire_key"), []byte("expire_value")); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, err := db.TTL([]byte("expire_key")); err != nil || ttl != NoExpiry {
+		t.Fatalf("Expected NoExpiry, got %v, err: %v", ttl, err)
+	}
+
+	if err := db.Expire([]byte("expire_key"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, err := db.TTL([]byte("expire_key")); err != nil || ttl <= time.Hour-time.Minute {
+		t.Fatalf("Expected TTL of about an hour, got %v, err: %v", ttl, err)
+	}
+
+	if err := db.Persist([]byte("expire_key")); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, err := db.TTL([]byte("expire_key")); err != nil || ttl != NoExpiry {
+		t.Fatalf("Expected NoExpiry after Persist, got %v, err: %v", ttl, err)
+	}
+	if v, err := db.Get([]byte("expire_key")); err != nil || string(v) != "expire_value" {
+		t.Fatalf("Expected expire_value, got %s, err: %v", v, err)
+	}
+}
+
+func TestTinyDB_TTLReopenAndMerge(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, WithTTLSweepInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the expired entry has to hide the older version without TTL
+	if err := db.Put([]byte("ttl_key_1"), []byte("old_value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutWithTTL([]byte("ttl_key_1"), []byte("new_value"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutWithTTL([]byte("ttl_key_2"), []byte("ttl_value_2"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	db.Close()
+
+	db, err = Open(dir, WithTTLSweepInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get([]byte("ttl_key_1")); err != ErrKeyNotFound {
+		t.Fatalf("Expected expired key to stay gone after reopen, got %v", err)
+	}
+	if ttl, err := db.TTL([]byte("ttl_key_2")); err != nil || ttl <= 0 {
+		t.Fatalf("Expected ttl_key_2 to keep its TTL, got %v, err: %v", ttl, err)
+	}
+
+	if err := db.PutWithTTL([]byte("ttl_key_3"), []byte("ttl_value_3"), 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := db.Stats(); stats.Keys != 1 {
+		t.Fatalf("Expected merge to drop the expired key, got %d keys", stats.Keys)
+	}
+	db.Close()
+
+	db, err = Open(dir, WithTTLSweepInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if ttl, err := db.TTL([]byte("ttl_key_2")); err != nil || ttl <= 0 {
+		t.Fatalf("Expected the hint file to keep the TTL, got %v, err: %v", ttl, err)
+	}
+}
+
+func TestTinyDB_TTLSweeper(t *testing.T) {
+	db, err := Open(t.TempDir(), WithTTLSweepInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.PutWithTTL([]byte("sweep_key"), []byte("sweep_value"), 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("keep_key"), []byte("keep_value")); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for db.Stats().Keys != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the sweeper to drop sweep_key, got %d keys", db.Stats().Keys)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats := db.Stats(); stats.DeadBytes == 0 {
+		t.Fatal("Expected the swept entry to count as dead bytes")
+	}
+}
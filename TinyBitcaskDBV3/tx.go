@@ -1,28 +1,45 @@
 package TinyBitcaskDBV3
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"sync"
 	"sync/atomic"
-	"time"
 )
 
 type Value []byte
 
-// Begin starts a new transaction
-func (db *TinyDB) Begin() *Tx {
+// Begin starts a new transaction that reads the database as of now. It must
+// be finished with Commit or RollBack, until then the entries it may read are
+// kept around.
+func (db *TinyDB) Begin() (*Tx, error) {
+	return db.begin(false)
+}
+
+func (db *TinyDB) begin(readOnly bool) (*Tx, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+
 	return &Tx{
 		db:        db,
 		done:      0,
+		readOnly:  readOnly,
+		startSeq:  db.acquireSnapshot(),
 		txKeyDir:  make(map[string]Value),
 		txEntries: make([]TxEntry, 0),
-	}
+		reads:     make(map[string]struct{}),
+	}, nil
 }
 
 // Tx is a transaction
-// Last write wins
+// Last write wins, in the order of seq
 type TxEntry struct {
-	ts    time.Time //
+	seq   uint64 // position of the write in the transaction
 	mark  uint16
 	key   []byte
 	value []byte
@@ -32,9 +49,12 @@ type Tx struct {
 	db        *TinyDB
 	mu        sync.RWMutex
 	done      uint32
-	txKeyDir  map[string]Value
+	readOnly  bool             // started by View, Put and Delete fail
+	startSeq  uint64           // reads see the commits up to this seq
+	txKeyDir  map[string]Value // values read from the snapshot
 	txEntries []TxEntry
-	//ts       time.Time // start time for transaction
+	nextSeq   uint64
+	reads     map[string]struct{} // keys read from the snapshot, checked on Commit
 }
 
 const (
@@ -44,12 +64,13 @@ const (
 
 var (
 	ErrTxDone       = errors.New("transaction done")
+	ErrTxReadOnly   = errors.New("transaction is read-only")
 	ErrKeyTooLong   = errors.New("key is too long")
 	ErrValueTooLong = errors.New("value is too long")
 )
 
-// Get returns the store value of the specified key. It takes key-value pairs
-// that will upload in the current transaction into account
+// Get returns the value of key as of the start of the transaction, or the
+// value the transaction itself wrote last
 func (t *Tx) Get(key []byte) ([]byte, error) {
 
 	if atomic.LoadUint32(&t.done) == 1 {
@@ -60,11 +81,21 @@ func (t *Tx) Get(key []byte) ([]byte, error) {
 		return nil, ErrKeyTooLong
 	}
 
-	t.mu.RLock()
-	defer t.mu.RUnlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := len(t.txEntries) - 1; i >= 0; i-- {
+		if txEntry := t.txEntries[i]; bytes.Equal(txEntry.key, key) {
+			if txEntry.mark == Delete {
+				return nil, ErrKeyNotFound
+			}
+			return txEntry.value, nil
+		}
+	}
+
 	v1, ok := t.txKeyDir[string(key)]
 	if !ok {
-		v2, err := t.db.Get(key)
+		t.reads[string(key)] = struct{}{}
+		v2, err := t.db.getAt(key, t.startSeq)
 		if err != nil {
 			return nil, err
 		}
@@ -81,70 +112,129 @@ func (t *Tx) Put(key, value []byte) error {
 		return ErrTxDone
 	}
 
-	if len(key) > maxKeyLen {
-		return ErrKeyTooLong
+	if t.readOnly {
+		return ErrTxReadOnly
 	}
 
-	if len(value) > maxValueLen {
-		return ErrValueTooLong
+	if err := t.db.checkWrite(key, value); err != nil {
+		return err
 	}
 
 	t.mu.Lock()
-	t.txEntries = append(t.txEntries, TxEntry{key: key, value: value, mark: Put, ts: time.Now()})
+	t.add(TxEntry{key: key, value: value, mark: Put})
 	t.mu.Unlock()
 	return nil
 }
 
-// delete
+// Delete removes key when the transaction commits, later Gets in the
+// transaction no longer find it
 func (t *Tx) Delete(key []byte) error {
 
 	if atomic.LoadUint32(&t.done) == 1 {
 		return ErrTxDone
 	}
 
-	if len(key) > maxKeyLen {
-		return ErrKeyTooLong
+	if t.readOnly {
+		return ErrTxReadOnly
+	}
+
+	if err := t.db.checkWrite(key, nil); err != nil {
+		return err
 	}
 
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	delete(t.txKeyDir, string(key))
+	t.add(TxEntry{key: key, mark: Delete})
 	return nil
 }
 
-// Commit commits the transaction
+// add records a write, the caller must hold t.mu
+func (t *Tx) add(txEntry TxEntry) {
+	t.nextSeq++
+	txEntry.seq = t.nextSeq
+	t.txEntries = append(t.txEntries, txEntry)
+}
+
+// Commit writes the transaction as one batch. It fails with ErrConflict if a
+// key the transaction read or wrote was committed by someone else after it
+// started, the transaction is done either way. Whatever the sync policy, the
+// batch is fsynced before Commit returns, as it always was.
 func (t *Tx) Commit() error {
 
 	if atomic.LoadUint32(&t.done) == 1 {
 		return ErrTxDone
 	}
 
+	// a snapshot is consistent in itself, reading alone never conflicts
+	if t.readOnly {
+		return t.RollBack()
+	}
+
 	//
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	m := make(map[string]TxEntry)
 	for _, txEntry := range t.txEntries {
-		key, ts := txEntry.key, txEntry.ts
+		key, seq := txEntry.key, txEntry.seq
 		if mTxEntry, ok := m[string(key)]; !ok {
 			m[string(key)] = txEntry
 		} else {
-			if ts.After(mTxEntry.ts) {
+			if seq > mTxEntry.seq {
 				m[string(key)] = txEntry
 			}
 		}
 	}
 
+	// the writes go out as one batch, a crash never leaves half of them
+	db := t.db
+	entries := make([]*Entry, 0, len(m))
 	for k, txEntry := range m {
-		if txEntry.mark == Put {
-			t.db.Put([]byte(k), txEntry.value)
-		} else {
-			t.db.Del([]byte(k))
+		if err := db.checkWrite([]byte(k), txEntry.value); err != nil {
+			t.abort()
+			return fmt.Errorf("commit key %q: %w", k, err)
 		}
+		entries = append(entries, NewEntry([]byte(k), txEntry.value, txEntry.mark, String))
 	}
 
-	atomic.CompareAndSwapUint32(&t.done, 0, 1)
+	err := db.write(true, func() error {
+		defer t.finish()
 
-	return t.db.Sync() // Write into disk
+		for k := range t.reads {
+			if db.changedSince([]byte(k), t.startSeq) {
+				return fmt.Errorf("%w: key %q was read", ErrConflict, k)
+			}
+		}
+		for k := range m {
+			if db.changedSince([]byte(k), t.startSeq) {
+				return fmt.Errorf("%w: key %q was written", ErrConflict, k)
+			}
+		}
+
+		if err := db.applyBatch(entries); err != nil {
+			return fmt.Errorf("commit: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		// the write group never ran fn if the database was closed
+		t.abort()
+	}
+	return err
+}
+
+// finish marks the transaction done and releases its snapshot, the caller
+// must hold t.db.mu
+func (t *Tx) finish() {
+	if atomic.CompareAndSwapUint32(&t.done, 0, 1) {
+		t.db.releaseSnapshot(t.startSeq)
+	}
+}
+
+// abort finishes the transaction without writing it
+func (t *Tx) abort() {
+	t.db.mu.Lock()
+	t.finish()
+	t.db.mu.Unlock()
 }
 
 // RollBack discard all changes of the current transaction
@@ -159,7 +249,46 @@ func (t *Tx) RollBack() error {
 	t.txKeyDir = nil
 	t.txEntries = nil
 
-	atomic.CompareAndSwapUint32(&t.done, 0, 1)
-
+	t.abort()
 	return nil
 }
+
+// Update runs fn in a transaction and commits it if fn returns nil, otherwise
+// or if fn panics the transaction is rolled back. A commit that fails with
+// ErrConflict is retried up to Options.TxRetries times, so fn may run more
+// than once.
+func (db *TinyDB) Update(fn func(tx *Tx) error) error {
+	for retry := 0; ; retry++ {
+		err := db.runTx(false, fn)
+		if !errors.Is(err, ErrConflict) || retry >= db.opts.TxRetries {
+			return err
+		}
+		db.logf("retry transaction after conflict: %v\n", err)
+	}
+}
+
+// View runs fn in a read-only transaction, Put and Delete fail with
+// ErrTxReadOnly
+func (db *TinyDB) View(fn func(tx *Tx) error) error {
+	return db.runTx(true, fn)
+}
+
+func (db *TinyDB) runTx(readOnly bool, fn func(tx *Tx) error) (err error) {
+	tx, err := db.begin(readOnly)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.RollBack()
+			panic(r)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		tx.RollBack()
+		return err
+	}
+	return tx.Commit()
+}
@@ -1,12 +1,16 @@
 package TinyBitcaskDBV3
 
-import "testing"
+import (
+	"errors"
+	"testing"
+)
 
 func TestTransaction(t *testing.T) {
-	db, err := Open(DirPath, DefaultDataType)
+	db, err := Open(t.TempDir())
 	if err != nil {
 		t.Error(err)
 	}
+	defer db.Close()
 
 	err = db.Put([]byte("key1"), []byte("value1"))
 	err = db.Put([]byte("key2"), []byte("value2"))
@@ -14,7 +18,10 @@ func TestTransaction(t *testing.T) {
 		t.Error("Put Origin data Error", err)
 	}
 
-	tx := db.Begin()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal("Begin Error: ", err)
+	}
 	err = tx.Put([]byte("key3"), []byte("value3"))
 	err = tx.Put([]byte("key2"), []byte("value4"))
 	if err != nil {
@@ -25,12 +32,13 @@ func TestTransaction(t *testing.T) {
 		t.Fatalf("Expected key1=value1, got key1=%s instead", string(v))
 	}
 
-	if v, err := tx.Get([]byte("key2")); err != nil || string(v) != "value2" {
-		t.Fatalf("Expected key2=value2, got key2=%s instead", string(v))
+	// the transaction sees its own writes
+	if v, err := tx.Get([]byte("key2")); err != nil || string(v) != "value4" {
+		t.Fatalf("Expected key2=value4, got key2=%s instead", string(v))
 	}
 
-	if v, err := tx.Get([]byte("key3")); err != nil || len(v) > 0 {
-		t.Fatalf("Expected key3 should not get, got key3=%s instead", string(v))
+	if v, err := tx.Get([]byte("key3")); err != nil || string(v) != "value3" {
+		t.Fatalf("Expected key3=value3, got key3=%s instead", string(v))
 	}
 
 	// db should: key1=value1, key2=value2
@@ -40,6 +48,10 @@ func TestTransaction(t *testing.T) {
 	if err != nil {
 		t.Error("Commit Error: ", err)
 	}
+	// the commit is fsynced under the default SyncNever
+	if written, synced := syncState(db); synced != written {
+		t.Fatalf("Expected the commit to be fsynced, got %d/%d", synced, written)
+	}
 	// db should: key1=value1, key2=value5, key3=value3
 	if v, err := db.Get([]byte("key1")); err != nil || string(v) != "value1" {
 		t.Fatalf("Expected key1=value1, got key1=%s instead, err: %s", string(v), err.Error())
@@ -56,10 +68,11 @@ func TestTransaction(t *testing.T) {
 }
 
 func TestTx_RollBack(t *testing.T) {
-	db, err := Open(DirPath, DefaultDataType)
+	db, err := Open(t.TempDir())
 	if err != nil {
 		t.Error(err)
 	}
+	defer db.Close()
 
 	err = db.Put([]byte("key1"), []byte("value1"))
 	err = db.Put([]byte("key2"), []byte("value2"))
@@ -67,7 +80,10 @@ func TestTx_RollBack(t *testing.T) {
 		t.Error("Put Origin data Error", err)
 	}
 
-	tx := db.Begin()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal("Begin Error: ", err)
+	}
 	err = tx.Put([]byte("key3"), []byte("value3"))
 	err = tx.Put([]byte("key2"), []byte("value4"))
 	if err != nil {
@@ -78,12 +94,13 @@ func TestTx_RollBack(t *testing.T) {
 		t.Fatalf("Expected key1=value1, got key1=%s instead", string(v))
 	}
 
-	if v, err := tx.Get([]byte("key2")); err != nil || string(v) != "value2" {
-		t.Fatalf("Expected key2=value2, got key2=%s instead", string(v))
+	// the transaction sees its own writes
+	if v, err := tx.Get([]byte("key2")); err != nil || string(v) != "value4" {
+		t.Fatalf("Expected key2=value4, got key2=%s instead", string(v))
 	}
 
-	if v, err := tx.Get([]byte("key3")); err != nil || len(v) > 0 {
-		t.Fatalf("Expected key3 should not get, got key3=%s instead", string(v))
+	if v, err := tx.Get([]byte("key3")); err != nil || string(v) != "value3" {
+		t.Fatalf("Expected key3=value3, got key3=%s instead", string(v))
 	}
 
 	// db should: key1=value1, key2=value2
@@ -102,8 +119,317 @@ func TestTx_RollBack(t *testing.T) {
 		t.Fatalf("Expected key2=value2, got key2=%s instead, err: %s", string(v), err.Error())
 	}
 
-	if v, err := db.Get([]byte("key3")); err != nil || len(v) > 0 {
-		t.Fatalf("Expected key3=, got key3=%s instead, err: %s", string(v), err.Error())
+	if v, err := db.Get([]byte("key3")); err != ErrKeyNotFound || len(v) > 0 {
+		t.Fatalf("Expected key3 not found, got key3=%s instead, err: %v", string(v), err)
+	}
+
+}
+
+func TestTx_CommitClosed(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal("Begin Error: ", err)
+	}
+	if err := tx.Put([]byte("key1"), []byte("value1")); err != nil {
+		t.Fatal("tx Put Error ", err)
+	}
+
+	db.Close()
+	if err := tx.Commit(); !errors.Is(err, ErrDBClosed) {
+		t.Errorf("Expected ErrDBClosed from Commit, got %v", err)
+	}
+	if len(db.snapshots) != 0 {
+		t.Errorf("Expected the failed commit to finish the transaction, got %d open", len(db.snapshots))
+	}
+}
+
+func TestTx_InvalidWrite(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, WithMaxKeySize(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Update(func(tx *Tx) error {
+		return tx.Put([]byte("toolongkey"), []byte("value"))
+	})
+	if err != ErrKeyTooLong {
+		t.Fatalf("Expected ErrKeyTooLong from Update, got %v", err)
+	}
+	if len(db.snapshots) != 0 {
+		t.Fatalf("Expected the transaction to be finished, got %d open", len(db.snapshots))
+	}
+	db.Put([]byte("key"), []byte("value"))
+	db.Close()
+
+	if db, err = Open(dir, WithReadOnly(true)); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, fn := range []func(tx *Tx) error{
+		func(tx *Tx) error { return tx.Put([]byte("key"), []byte("value2")) },
+		func(tx *Tx) error { return tx.Delete([]byte("key")) },
+	} {
+		if err := db.Update(fn); err != ErrReadOnly {
+			t.Fatalf("Expected ErrReadOnly from Update, got %v", err)
+		}
+	}
+	if len(db.snapshots) != 0 {
+		t.Fatalf("Expected the transactions to be finished, got %d open", len(db.snapshots))
+	}
+}
+
+func TestTx_SnapshotIsolation(t *testing.T) {
+	db, err := Open(t.TempDir(), WithMaxFileSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	db.Put([]byte("key1"), []byte("value1"))
+	db.Put([]byte("key2"), []byte("value2"))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal("Begin Error: ", err)
+	}
+
+	// commits after Begin are invisible to the transaction, even once the
+	// replaced entries were merged away
+	db.Put([]byte("key1"), []byte("value1_new"))
+	db.Del([]byte("key2"))
+	db.Put([]byte("key3"), []byte("value3"))
+	if err := db.Merge(); err != nil {
+		t.Fatal("Merge Error: ", err)
+	}
+
+	if v, err := tx.Get([]byte("key1")); err != nil || string(v) != "value1" {
+		t.Fatalf("Expected key1=value1 in the snapshot, got %s, err: %v", string(v), err)
+	}
+	if v, err := tx.Get([]byte("key2")); err != nil || string(v) != "value2" {
+		t.Fatalf("Expected key2=value2 in the snapshot, got %s, err: %v", string(v), err)
+	}
+	if v, err := tx.Get([]byte("key3")); err != ErrKeyNotFound {
+		t.Fatalf("Expected key3 to be missing in the snapshot, got %s, err: %v", string(v), err)
+	}
+
+	if err := tx.RollBack(); err != nil {
+		t.Fatal("RollBack Error: ", err)
+	}
+	if len(db.versions) != 0 || len(db.retired) != 0 {
+		t.Fatalf("Expected versions and retired files to be released, got %d versions, %d files", len(db.versions), len(db.retired))
+	}
+	if v, err := db.Get([]byte("key1")); err != nil || string(v) != "value1_new" {
+		t.Fatalf("Expected key1=value1_new, got %s, err: %v", string(v), err)
+	}
+}
+
+func TestTx_Conflict(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	db.Put([]byte("key1"), []byte("value1"))
+
+	// read-write conflict
+	tx1, _ := db.Begin()
+	if _, err := tx1.Get([]byte("key1")); err != nil {
+		t.Fatal(err)
+	}
+	tx1.Put([]byte("key2"), []byte("value2"))
+	db.Put([]byte("key1"), []byte("value1_new"))
+	if err := tx1.Commit(); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Expected ErrConflict for a read key, got %v", err)
+	}
+	if _, err := db.Get([]byte("key2")); err != ErrKeyNotFound {
+		t.Fatalf("Expected the conflicting transaction to write nothing, got %v", err)
+	}
+	if err := tx1.Commit(); err != ErrTxDone {
+		t.Fatalf("Expected ErrTxDone after a conflict, got %v", err)
+	}
+
+	// write-write conflict between two transactions
+	tx2, _ := db.Begin()
+	tx3, _ := db.Begin()
+	tx2.Put([]byte("key3"), []byte("value3_tx2"))
+	tx3.Put([]byte("key3"), []byte("value3_tx3"))
+	if err := tx2.Commit(); err != nil {
+		t.Fatal("Commit Error: ", err)
+	}
+	if err := tx3.Commit(); !errors.Is(err, ErrConflict) {
+		t.Fatalf("Expected ErrConflict for a written key, got %v", err)
+	}
+	if v, err := db.Get([]byte("key3")); err != nil || string(v) != "value3_tx2" {
+		t.Fatalf("Expected key3=value3_tx2, got %s, err: %v", string(v), err)
+	}
+
+	// disjoint keys commit side by side
+	tx4, _ := db.Begin()
+	tx5, _ := db.Begin()
+	tx4.Put([]byte("key4"), []byte("value4"))
+	tx5.Put([]byte("key5"), []byte("value5"))
+	if err := tx4.Commit(); err != nil {
+		t.Fatal("Commit Error: ", err)
+	}
+	if err := tx5.Commit(); err != nil {
+		t.Fatal("Commit Error: ", err)
+	}
+}
+
+func TestTx_Delete(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.Put([]byte("key1"), []byte("value1"))
+	db.Put([]byte("key2"), []byte("value2"))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal("Begin Error: ", err)
+	}
+	if err := tx.Delete([]byte("key1")); err != nil {
+		t.Fatal("tx Delete Error: ", err)
+	}
+	if v, err := tx.Get([]byte("key1")); err != ErrKeyNotFound {
+		t.Fatalf("Expected key1 to be deleted in the transaction, got %s, err: %v", string(v), err)
+	}
+	if v, err := db.Get([]byte("key1")); err != nil || string(v) != "value1" {
+		t.Fatalf("Expected key1=value1 before Commit, got %s, err: %v", string(v), err)
 	}
 
+	// the last write of a key wins, in the order of the transaction
+	tx.Put([]byte("key2"), []byte("value2_tx"))
+	tx.Delete([]byte("key2"))
+	tx.Put([]byte("key2"), []byte("value2_final"))
+	tx.Put([]byte("key3"), []byte("value3"))
+	tx.Delete([]byte("key3"))
+	if v, err := tx.Get([]byte("key2")); err != nil || string(v) != "value2_final" {
+		t.Fatalf("Expected key2=value2_final in the transaction, got %s, err: %v", string(v), err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal("Commit Error: ", err)
+	}
+
+	check := func(db *TinyDB) {
+		if v, err := db.Get([]byte("key1")); err != ErrKeyNotFound {
+			t.Fatalf("Expected key1 to be deleted, got %s, err: %v", string(v), err)
+		}
+		if v, err := db.Get([]byte("key2")); err != nil || string(v) != "value2_final" {
+			t.Fatalf("Expected key2=value2_final, got %s, err: %v", string(v), err)
+		}
+		if v, err := db.Get([]byte("key3")); err != ErrKeyNotFound {
+			t.Fatalf("Expected key3 to be deleted, got %s, err: %v", string(v), err)
+		}
+	}
+
+	check(db)
+	db.Close()
+	if db, err = Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(db)
+}
+
+func TestTinyDB_UpdateAndView(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *Tx) error {
+		return tx.Put([]byte("key1"), []byte("value1"))
+	})
+	if err != nil {
+		t.Fatal("Update Error: ", err)
+	}
+
+	errAbort := errors.New("abort")
+	err = db.Update(func(tx *Tx) error {
+		tx.Put([]byte("key2"), []byte("value2"))
+		return errAbort
+	})
+	if err != errAbort {
+		t.Fatalf("Expected the error of fn, got %v", err)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("Expected Update to re-panic")
+			}
+		}()
+		db.Update(func(tx *Tx) error {
+			tx.Put([]byte("key3"), []byte("value3"))
+			panic("boom")
+		})
+	}()
+	if len(db.snapshots) != 0 {
+		t.Fatalf("Expected every transaction to be finished, got %d open", len(db.snapshots))
+	}
+
+	err = db.View(func(tx *Tx) error {
+		if v, err := tx.Get([]byte("key1")); err != nil || string(v) != "value1" {
+			t.Fatalf("Expected key1=value1, got %s, err: %v", string(v), err)
+		}
+		for _, key := range []string{"key2", "key3"} {
+			if _, err := tx.Get([]byte(key)); err != ErrKeyNotFound {
+				t.Fatalf("Expected %s to be rolled back, got %v", key, err)
+			}
+		}
+		if err := tx.Put([]byte("key4"), []byte("value4")); err != ErrTxReadOnly {
+			t.Fatalf("Expected ErrTxReadOnly from Put, got %v", err)
+		}
+		if err := tx.Delete([]byte("key1")); err != ErrTxReadOnly {
+			t.Fatalf("Expected ErrTxReadOnly from Delete, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("View Error: ", err)
+	}
+}
+
+func TestTinyDB_UpdateRetry(t *testing.T) {
+	for _, retries := range []int{0, 1} {
+		db, err := Open(t.TempDir(), WithTxRetries(retries))
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.Put([]byte("counter"), []byte("0"))
+
+		attempts := 0
+		err = db.Update(func(tx *Tx) error {
+			attempts++
+			if _, err := tx.Get([]byte("counter")); err != nil {
+				return err
+			}
+			if attempts == 1 {
+				// a concurrent writer gets in between the read and the commit
+				db.Put([]byte("counter"), []byte("1"))
+			}
+			return tx.Put([]byte("counter"), []byte("2"))
+		})
+
+		if retries == 0 && (!errors.Is(err, ErrConflict) || attempts != 1) {
+			t.Fatalf("Expected ErrConflict after 1 attempt, got %v after %d", err, attempts)
+		}
+		if retries == 1 && (err != nil || attempts != 2) {
+			t.Fatalf("Expected success after 2 attempts, got %v after %d", err, attempts)
+		}
+		db.Close()
+	}
 }
@@ -0,0 +1,355 @@
+package TinyBitcaskDBV3
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var (
+	ErrInvalidScore = errors.New("score is not a number")
+)
+
+// ZMember is a member of a sorted set with its score
+type ZMember struct {
+	Member []byte
+	Score  float64
+}
+
+// zset is the in-memory form of a sorted set
+type zset struct {
+	scores map[string]float64
+	list   *skipList
+}
+
+// zsetKeydir indexes the member records of every sorted set and keeps each set
+// ordered by score. A member record holds the score as its value, Open reads
+// them back to rebuild the skip lists.
+type zsetKeydir struct {
+	*memberKeydir
+	zsets map[string]*zset
+}
+
+func newZSetKeydir() *zsetKeydir {
+	return &zsetKeydir{memberKeydir: newMemberKeydir(), zsets: make(map[string]*zset)}
+}
+
+func (z *zsetKeydir) Delete(rk []byte) (*Pos, bool) {
+	pos, ok := z.memberKeydir.Delete(rk)
+	if ok {
+		key, member := decodeSubKey(rk)
+		z.remove(key, member)
+	}
+	return pos, ok
+}
+
+// get returns the sorted set at key, nil if it is empty
+func (z *zsetKeydir) get(key []byte) *zset {
+	return z.zsets[string(key)]
+}
+
+// setScore moves member of the sorted set at key to score
+func (z *zsetKeydir) setScore(key, member []byte, score float64) {
+	zs, ok := z.zsets[string(key)]
+	if !ok {
+		zs = &zset{scores: make(map[string]float64), list: newSkipList()}
+		z.zsets[string(key)] = zs
+	}
+
+	if old, ok := zs.scores[string(member)]; ok {
+		if old == score {
+			return
+		}
+		zs.list.delete(old, string(member))
+	}
+	zs.scores[string(member)] = score
+	zs.list.insert(score, string(member))
+}
+
+func (z *zsetKeydir) remove(key, member []byte) {
+	zs, ok := z.zsets[string(key)]
+	if !ok {
+		return
+	}
+	if score, ok := zs.scores[string(member)]; ok {
+		zs.list.delete(score, string(member))
+		delete(zs.scores, string(member))
+	}
+	if len(zs.scores) == 0 {
+		delete(z.zsets, string(key))
+	}
+}
+
+// zsetKey is the record key of member of the sorted set at key
+func zsetKey(key, member []byte) []byte {
+	return encodeSubKey(key, member)
+}
+
+func encodeScore(score float64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, math.Float64bits(score))
+	return buf
+}
+
+func decodeScore(buf []byte) (float64, error) {
+	if len(buf) != 8 {
+		return 0, ErrInvalidEntry
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(buf)), nil
+}
+
+// loadZSets reads the scores of all sorted set members once the keydir is
+// rebuilt, the caller must hold db.mu
+func (db *TinyDB) loadZSets() error {
+	for key, members := range db.zsets.keys {
+		for member := range members {
+			if err := db.loadZSetMember(zsetKey([]byte(key), []byte(member))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadZSetMember syncs the skip list with the member record rk, the caller
+// must hold db.mu
+func (db *TinyDB) loadZSetMember(rk []byte) error {
+	key, member := decodeSubKey(rk)
+	value, err := db.readRecord(ZSet, rk)
+	if err == ErrKeyNotFound {
+		db.zsets.remove(key, member)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	score, err := decodeScore(value)
+	if err != nil {
+		return err
+	}
+	db.zsets.setScore(key, member, score)
+	return nil
+}
+
+// ZAdd sets the score of member of the sorted set at key
+func (db *TinyDB) ZAdd(key []byte, score float64, member []byte) error {
+	if err := db.checkMember(key, member, nil); err != nil {
+		return err
+	}
+	if math.IsNaN(score) {
+		return ErrInvalidScore
+	}
+
+	return db.write(false, func() error {
+		return db.putZSetMember(key, member, score)
+	})
+}
+
+// putZSetMember is ZAdd with db.mu held
+func (db *TinyDB) putZSetMember(key, member []byte, score float64) error {
+	if zs := db.zsets.get(key); zs != nil {
+		if old, ok := zs.scores[string(member)]; ok && old == score {
+			return nil
+		}
+	}
+
+	if err := db.writeRecord(NewEntry(zsetKey(key, member), encodeScore(score), Put, ZSet)); err != nil {
+		return err
+	}
+	db.zsets.setScore(key, member, score)
+	return nil
+}
+
+// ZScore returns the score of member of the sorted set at key
+func (db *TinyDB) ZScore(key, member []byte) (float64, error) {
+	if len(key) == 0 {
+		return 0, ErrEmptyKey
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return 0, ErrDBClosed
+	}
+	if err := db.checkType(key, ZSet); err != nil {
+		return 0, err
+	}
+
+	if zs := db.zsets.get(key); zs != nil {
+		if score, ok := zs.scores[string(member)]; ok {
+			return score, nil
+		}
+	}
+	return 0, ErrKeyNotFound
+}
+
+// ZRem removes members from the sorted set at key with a single batch and
+// returns how many of them were in it
+func (db *TinyDB) ZRem(key []byte, members ...[]byte) (n int, err error) {
+	if err = db.checkWrite(key, nil); err != nil {
+		return
+	}
+
+	err = db.write(false, func() error {
+		if err := db.checkType(key, ZSet); err != nil {
+			return err
+		}
+		zs := db.zsets.get(key)
+		if zs == nil {
+			return nil
+		}
+
+		seen := make(map[string]bool, len(members))
+		var entries []*Entry
+		for _, member := range members {
+			if _, ok := zs.scores[string(member)]; !ok || seen[string(member)] {
+				continue
+			}
+			seen[string(member)] = true
+			entries = append(entries, NewEntry(zsetKey(key, member), nil, Delete, ZSet))
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		if err := db.writeRecords(entries); err != nil {
+			return err
+		}
+		n = len(entries)
+		return nil
+	})
+	return
+}
+
+// ZRank returns the 0 based position of member in the sorted set at key, by
+// ascending score
+func (db *TinyDB) ZRank(key, member []byte) (int, error) {
+	if len(key) == 0 {
+		return 0, ErrEmptyKey
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return 0, ErrDBClosed
+	}
+	if err := db.checkType(key, ZSet); err != nil {
+		return 0, err
+	}
+
+	if zs := db.zsets.get(key); zs != nil {
+		if score, ok := zs.scores[string(member)]; ok {
+			return zs.list.rank(score, string(member)), nil
+		}
+	}
+	return 0, ErrKeyNotFound
+}
+
+// ZRange returns the members of the sorted set at key from rank start to stop,
+// both inclusive, negative ranks count from the highest score
+func (db *TinyDB) ZRange(key []byte, start, stop int) ([]ZMember, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+	if err := db.checkType(key, ZSet); err != nil {
+		return nil, err
+	}
+
+	zs := db.zsets.get(key)
+	if zs == nil {
+		return nil, nil
+	}
+	start, stop, ok := listRange(start, stop, zs.list.length)
+	if !ok {
+		return nil, nil
+	}
+
+	out := make([]ZMember, 0, stop-start+1)
+	for x := zs.list.byRank(start); x != nil && len(out) < stop-start+1; x = x.level[0].forward {
+		out = append(out, ZMember{Member: []byte(x.member), Score: x.score})
+	}
+	return out, nil
+}
+
+// ZRangeByScore returns the members of the sorted set at key with a score
+// between min and max, both inclusive, by ascending score
+func (db *TinyDB) ZRangeByScore(key []byte, min, max float64) ([]ZMember, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+	if err := db.checkType(key, ZSet); err != nil {
+		return nil, err
+	}
+
+	zs := db.zsets.get(key)
+	if zs == nil {
+		return nil, nil
+	}
+
+	var out []ZMember
+	for x := zs.list.firstFrom(min); x != nil && x.score <= max; x = x.level[0].forward {
+		out = append(out, ZMember{Member: []byte(x.member), Score: x.score})
+	}
+	return out, nil
+}
+
+// ZIncrBy adds incr to the score of member of the sorted set at key and
+// returns the new score, a missing member starts at 0
+func (db *TinyDB) ZIncrBy(key []byte, incr float64, member []byte) (score float64, err error) {
+	if err = db.checkMember(key, member, nil); err != nil {
+		return
+	}
+	if math.IsNaN(incr) {
+		return 0, ErrInvalidScore
+	}
+
+	err = db.write(false, func() error {
+		if zs := db.zsets.get(key); zs != nil {
+			score = zs.scores[string(member)]
+		}
+		score += incr
+		if math.IsNaN(score) {
+			return ErrInvalidScore
+		}
+		return db.putZSetMember(key, member, score)
+	})
+	return
+}
+
+// ZCard returns the number of members of the sorted set at key
+func (db *TinyDB) ZCard(key []byte) (int, error) {
+	if len(key) == 0 {
+		return 0, ErrEmptyKey
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return 0, ErrDBClosed
+	}
+	if err := db.checkType(key, ZSet); err != nil {
+		return 0, err
+	}
+
+	if zs := db.zsets.get(key); zs != nil {
+		return zs.list.length, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,159 @@
+package TinyBitcaskDBV3
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func zMembers(pairs ...interface{}) []ZMember {
+	var out []ZMember
+	for i := 0; i < len(pairs); i += 2 {
+		out = append(out, ZMember{Member: []byte(pairs[i].(string)), Score: pairs[i+1].(float64)})
+	}
+	return out
+}
+
+func TestZSet(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	key := []byte("zset_key")
+	for member, score := range map[string]float64{"alice": 30, "bob": 10, "carol": 20, "dave": 20} {
+		if err := db.ZAdd(key, score, []byte(member)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.ZAdd(key, 5, []byte("alice")); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := db.ZScore(key, []byte("alice")); err != nil || s != 5 {
+		t.Fatalf("Expected 5, got %v, err: %v", s, err)
+	}
+	if _, err := db.ZScore(key, []byte("missing")); err != ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+	if r, err := db.ZRank(key, []byte("dave")); err != nil || r != 3 {
+		t.Fatalf("Expected rank 3, got %d, err: %v", r, err)
+	}
+	if n, err := db.ZCard(key); err != nil || n != 4 {
+		t.Fatalf("Expected 4 members, got %d, err: %v", n, err)
+	}
+
+	members, err := db.ZRange(key, 0, -1)
+	if err != nil || !reflect.DeepEqual(members, zMembers("alice", 5.0, "bob", 10.0, "carol", 20.0, "dave", 20.0)) {
+		t.Fatalf("Unexpected ZRange %v, err: %v", members, err)
+	}
+	if members, err = db.ZRange(key, -2, 10); err != nil || !reflect.DeepEqual(members, zMembers("carol", 20.0, "dave", 20.0)) {
+		t.Fatalf("Unexpected ZRange %v, err: %v", members, err)
+	}
+	if members, err = db.ZRangeByScore(key, 6, 20); err != nil || !reflect.DeepEqual(members, zMembers("bob", 10.0, "carol", 20.0, "dave", 20.0)) {
+		t.Fatalf("Unexpected ZRangeByScore %v, err: %v", members, err)
+	}
+	if members, err = db.ZRangeByScore(key, 21, math.Inf(1)); err != nil || len(members) != 0 {
+		t.Fatalf("Expected no members above 21, got %v, err: %v", members, err)
+	}
+
+	if s, err := db.ZIncrBy(key, 15, []byte("bob")); err != nil || s != 25 {
+		t.Fatalf("Expected 25, got %v, err: %v", s, err)
+	}
+	if s, err := db.ZIncrBy(key, -1.5, []byte("erin")); err != nil || s != -1.5 {
+		t.Fatalf("Expected -1.5, got %v, err: %v", s, err)
+	}
+	if r, err := db.ZRank(key, []byte("bob")); err != nil || r != 4 {
+		t.Fatalf("Expected rank 4, got %d, err: %v", r, err)
+	}
+	if err := db.ZAdd(key, math.NaN(), []byte("nan")); err != ErrInvalidScore {
+		t.Fatalf("Expected ErrInvalidScore, got %v", err)
+	}
+
+	if n, err := db.ZRem(key, []byte("alice"), []byte("erin"), []byte("missing")); err != nil || n != 2 {
+		t.Fatalf("Expected 2 members removed, got %d, err: %v", n, err)
+	}
+	if members, err = db.ZRange(key, 0, -1); err != nil || !reflect.DeepEqual(members, zMembers("carol", 20.0, "dave", 20.0, "bob", 25.0)) {
+		t.Fatalf("Unexpected ZRange %v, err: %v", members, err)
+	}
+}
+
+func TestZSet_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, WithMaxFileSize(512))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := []byte("leaderboard")
+	for i := 0; i < 40; i++ {
+		if _, err := db.ZIncrBy(key, float64(i), []byte(fmt.Sprintf("player_%d", i%8))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.ZRem(key, []byte("player_0"))
+
+	// player_n scored n + (n+8) + (n+16) + (n+24) + (n+32)
+	expected := zMembers("player_1", 85.0, "player_2", 90.0, "player_3", 95.0, "player_4", 100.0, "player_5", 105.0, "player_6", 110.0, "player_7", 115.0)
+	check := func(db *TinyDB) {
+		t.Helper()
+		members, err := db.ZRange(key, 0, -1)
+		if err != nil || !reflect.DeepEqual(members, expected) {
+			t.Fatalf("Unexpected ZRange %v, err: %v", members, err)
+		}
+	}
+
+	check(db)
+	db.Close()
+	if db, err = Open(dir, WithMaxFileSize(512)); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+
+	if err := db.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	check(db)
+	db.Close()
+	if db, err = Open(dir, WithMaxFileSize(512)); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(db)
+}
+
+func TestZSet_Rollback(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	key := []byte("rollback_zset")
+	if err := db.ZAdd(key, 1, []byte("member")); err != nil {
+		t.Fatal(err)
+	}
+
+	file := db.activeFile.File
+	readOnly, err := os.Open(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.activeFile.File = readOnly
+	if err := db.ZAdd(key, 2, []byte("member")); err == nil {
+		t.Fatal("Expected the write to fail")
+	}
+	if err := db.ZAdd(key, 3, []byte("new_member")); err == nil {
+		t.Fatal("Expected the write to fail")
+	}
+	db.activeFile.File = file
+	readOnly.Close()
+
+	members, err := db.ZRange(key, 0, -1)
+	if err != nil || !reflect.DeepEqual(members, zMembers("member", 1.0)) {
+		t.Fatalf("Expected the failed writes to be rolled back, got %v, err: %v", members, err)
+	}
+}